@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Returns a bootstrap resample of ms: len(ms) measurements drawn uniformly with replacement.
+func resample(ms []Measurement, rng *rand.Rand) []Measurement {
+	sample := make([]Measurement, len(ms))
+	for i := range sample {
+		sample[i] = ms[rng.Intn(len(ms))]
+	}
+	return sample
+}
+
+// Fits all styles to n bootstrap resamples of ms and counts how many resamples each style won,
+// indexed in the same order as styles. Resamples where no style could be fit, for example
+// because every drawn measurement was the same, are not counted towards any style.
+func benchmarkStyleWins(ms []Measurement, styles []ReportingStyle, opts fitOptions, n int,
+	rng *rand.Rand) []int {
+	wins := make([]int, len(styles))
+	for i := 0; i < n; i++ {
+		results := fitStyles(resample(ms, rng), styles, opts)
+		best := findBestResult(results)
+		if math.IsNaN(best.Error) {
+			continue
+		}
+		for j, r := range results {
+			if r.Type == best.Type {
+				wins[j]++
+				break
+			}
+		}
+	}
+	return wins
+}
+
+func printStyleWins(styles []ReportingStyle, wins []int, n int) {
+	fmt.Printf("Style wins over %d bootstrap resamples:\n", n)
+	for i, style := range styles {
+		fmt.Printf("%-10s %6.1f%%\n", style.Type(), 100*float64(wins[i])/float64(n))
+	}
+}
+
+// Returns a copy of ms with independent normally distributed noise of the given standard
+// deviation added to each reported value.
+func jitter(ms []Measurement, sigma float64, rng *rand.Rand) []Measurement {
+	jittered := make([]Measurement, len(ms))
+	for i, m := range ms {
+		m.Reported += rng.NormFloat64() * sigma
+		jittered[i] = m
+	}
+	return jittered
+}
+
+// Refits style to n jittered copies of ms and prints the mean and standard deviation of the
+// fitted scale and bias, showing how sensitive the fit is to noise in the reported values.
+// Unlike bootstrapping, every trial keeps all of the measurements.
+func printJitterSensitivity(ms []Measurement, style ReportingStyle, opts fitOptions, sigma float64,
+	n int, rng *rand.Rand) {
+	scales := make([]float64, n)
+	biases := make([]float64, n)
+	for i := 0; i < n; i++ {
+		r := fitStyle(jitter(ms, sigma, rng), style, opts)
+		scales[i], biases[i] = r.Scale, r.Bias
+	}
+	avgScale, avgBias := average(scales), average(biases)
+	fmt.Printf("Jitter sensitivity of %s over %d trials with reported stddev %g:\n",
+		style.Type(), n, sigma)
+	fmt.Printf("Scale: mean=%f, stddev=%f\n", avgScale, stddev(scales, avgScale))
+	fmt.Printf("Bias: mean=%f, stddev=%f\n", avgBias, stddev(biases, avgBias))
+}
+
+// Refits style to n bootstrap resamples of ms and returns r with its scale and bias replaced by
+// their means over the resamples, along with their standard deviations. The error is recomputed
+// for the mean line over all of ms, so it is never lower than the error of r itself. Resamples
+// that couldn't be fit are skipped; ok is false if none could.
+func bootstrapEstimate(ms []Measurement, style ReportingStyle, opts fitOptions, r OptimizationResult,
+	n int, rng *rand.Rand) (estimate OptimizationResult, scaleStdDev, biasStdDev float64, ok bool) {
+	var scales, biases []float64
+	for i := 0; i < n; i++ {
+		sample := fitStyle(resample(ms, rng), style, opts)
+		if math.IsNaN(sample.Scale) || math.IsNaN(sample.Bias) || math.IsInf(sample.Scale, 0) {
+			continue
+		}
+		scales = append(scales, sample.Scale)
+		biases = append(biases, sample.Bias)
+	}
+	if len(scales) == 0 {
+		return r, 0, 0, false
+	}
+	estimate = r
+	estimate.Scale, estimate.Bias = average(scales), average(biases)
+	scaled := make([]Measurement, len(ms))
+	for i, m := range ms {
+		scaled[i] = style.Apply(m)
+	}
+	estimate.Error = calculateError(scaled, estimate.Scale, estimate.Bias)
+	return estimate, stddev(scales, estimate.Scale), stddev(biases, estimate.Bias), true
+}
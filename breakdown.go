@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+)
+
+// How far past the measured physical range, as a multiple of its width, a corrupted
+// measurement's physical size is moved. Far enough to be a gross error for any style.
+const corruptionFactor = 10
+
+// Estimates the breakdown point of fitting style with opts: the worst fitting measurement that
+// hasn't been corrupted yet is repeatedly replaced with a gross error and the fit redone, printing
+// each refit's RMS error against the original measurements, until that error exceeds threshold
+// mm or only two clean measurements remain.
+func printBreakdown(ms []Measurement, style ReportingStyle, opts fitOptions, threshold float64) {
+	r, err := Fit(ms, style, opts)
+	if err != nil {
+		log.Fatalf("-breakdown: %v", err)
+	}
+	pr := physicalRange(ms)
+	offset := corruptionFactor * math.Max(pr.Hi-pr.Lo, 1)
+	corrupted := append([]Measurement(nil), ms...)
+	clean := make([]bool, len(ms))
+	for i := range clean {
+		clean[i] = true
+	}
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Corrupted\tFraction\tScale\tBias\tRMS error")
+	fmt.Fprintf(tw, "0\t0.000\t%f\t%f\t%f\n", r.Scale, r.Bias, cleanRMS(style, r, ms))
+	for k := 1; k <= len(ms)-2; k++ {
+		worst, worstRes := -1, -1.0
+		for i, res := range residuals(style, r, corrupted) {
+			if clean[i] && math.Abs(res) > worstRes {
+				worst, worstRes = i, math.Abs(res)
+			}
+		}
+		clean[worst] = false
+		corrupted[worst].Physical += offset
+		if r, err = Fit(corrupted, style, opts); err != nil {
+			tw.Flush()
+			fmt.Printf("Fit failed with %d corrupted measurements: %v\n", k, err)
+			return
+		}
+		rms := cleanRMS(style, r, ms)
+		fraction := float64(k) / float64(len(ms))
+		fmt.Fprintf(tw, "%d\t%.3f\t%f\t%f\t%f\n", k, fraction, r.Scale, r.Bias, rms)
+		if rms > threshold {
+			tw.Flush()
+			fmt.Printf("Breakdown point: the RMS error exceeds %g mm once %.1f%% of the "+
+				"measurements are corrupted\n", threshold, 100*fraction)
+			return
+		}
+	}
+	tw.Flush()
+	fmt.Printf("The RMS error stayed within %g mm with all but two measurements corrupted\n",
+		threshold)
+}
+
+// Returns the unweighted RMS error of the fit r of style against the measurements ms.
+func cleanRMS(style ReportingStyle, r OptimizationResult, ms []Measurement) float64 {
+	sse := float64(0)
+	for _, res := range residuals(style, r, ms) {
+		sse += res * res
+	}
+	return math.Sqrt(sse / float64(len(ms)))
+}
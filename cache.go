@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// The most fits fitCache holds before it is cleared. Bootstrap and jitter trials fit many
+// distinct datasets that will never be seen again, so the cache must not grow without bound.
+const maxCachedFits = 1024
+
+// Identifies a fit: the measurements as the style transforms them, in order and including their
+// weights, the style's type and the fit options. fitStyle only sees the transformed measurements,
+// so keying on them rather than on the type alone keeps styles that share a name, such as a
+// -style-search transform and a plugin, from being served each other's fits.
+type fitKey struct {
+	Data     [sha256.Size]byte
+	Style    string
+	Anchored bool
+	Anchor   [2]float64
+	TheilSen bool
+	Prior    [2]float64
+	// The prior bias, if PenalizeBias.
+	PriorBias       float64
+	PenalizeBias    bool
+	InverseResidual bool
+}
+
+func newFitKey(ms []Measurement, style ReportingStyle, opts fitOptions) fitKey {
+	h := sha256.New()
+	var buf [8]byte
+	for _, m := range ms {
+		m = style.Apply(m)
+		for _, v := range []float64{m.Physical, m.Reported, m.Weight} {
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+			h.Write(buf[:])
+		}
+	}
+	k := fitKey{Style: style.Type(), TheilSen: opts.TheilSen,
+		Prior: [2]float64{opts.PriorScale, opts.PriorWeight}, PenalizeBias: opts.PenalizeBias,
+		InverseResidual: opts.InverseResidual}
+	if opts.PenalizeBias {
+		k.PriorBias = opts.PriorBias
+	}
+	h.Sum(k.Data[:0])
+	if opts.Anchor != nil {
+		anchor := style.Apply(*opts.Anchor)
+		k.Anchored = true
+		k.Anchor = [2]float64{anchor.Physical, anchor.Reported}
+	}
+	return k
+}
+
+// Memoizes fitStyle so that repeated fits of identical data, such as the base fit that several
+// diagnostics and every -serve request for the same capture recompute, are only done once. It is
+// safe for concurrent use.
+//
+// Entries never go stale: a fit is a pure function of its key, which hashes every value of the
+// measurements rather than, say, their count, so different data can't be served another's fit.
+// The only invalidation is for memory: once maxCachedFits entries are held the whole cache is
+// dropped, which is cheaper than tracking recency and costs at most one refit of the data that
+// is reused.
+type fitCache struct {
+	mu      sync.Mutex
+	results map[fitKey]OptimizationResult
+}
+
+var fits = &fitCache{results: make(map[fitKey]OptimizationResult)}
+
+// Returns fitStyle(ms, style, opts), computing it only if it isn't already cached.
+func (c *fitCache) Fit(ms []Measurement, style ReportingStyle, opts fitOptions) OptimizationResult {
+	k := newFitKey(ms, style, opts)
+	c.mu.Lock()
+	r, ok := c.results[k]
+	c.mu.Unlock()
+	if ok {
+		return r
+	}
+	r = fitStyle(ms, style, opts)
+	c.mu.Lock()
+	if len(c.results) >= maxCachedFits {
+		c.results = make(map[fitKey]OptimizationResult)
+	}
+	c.results[k] = r
+	c.mu.Unlock()
+	return r
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestFitCacheSameLengthDatasets(t *testing.T) {
+	c := &fitCache{results: make(map[fitKey]OptimizationResult)}
+	style := lookupStyle("diameter")
+	a, b := testMeasurements(20, 1), testMeasurements(20, 2)
+	ra := c.Fit(a, style, fitOptions{})
+	rb := c.Fit(b, style, fitOptions{})
+	if ra == rb {
+		t.Fatalf("datasets of the same length got the same fit %v", ra)
+	}
+	if want := fitStyle(b, style, fitOptions{}); rb != want {
+		t.Errorf("cached fit of the second dataset is %v, want %v", rb, want)
+	}
+	if got := c.Fit(a, style, fitOptions{}); got != ra {
+		t.Errorf("refit of the first dataset is %v, want %v", got, ra)
+	}
+}
+
+func TestFitCacheSameNameStyles(t *testing.T) {
+	c := &fitCache{results: make(map[fitKey]OptimizationResult)}
+	ms := testMeasurements(20, 1)
+	// Two styles of the same type with different transforms, as a -style-search candidate and a
+	// plugin could be.
+	identity := transformStyle{"x", "", func(x float64) float64 { return x }}
+	square := transformStyle{"x", "", func(x float64) float64 { return x * x }}
+	ri := c.Fit(ms, identity, fitOptions{})
+	rs := c.Fit(ms, square, fitOptions{})
+	if want := fitStyle(ms, square, fitOptions{}); rs != want {
+		t.Errorf("fit of the second style is %v, want its own fit %v, not the first's %v", rs,
+			want, ri)
+	}
+}
+
+func BenchmarkFitCache(b *testing.B) {
+	ms := testMeasurements(1000, 1)
+	style := lookupStyle("area")
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fitStyle(ms, style, fitOptions{})
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		c := &fitCache{results: make(map[fitKey]OptimizationResult)}
+		for i := 0; i < b.N; i++ {
+			c.Fit(ms, style, fitOptions{})
+		}
+	})
+}
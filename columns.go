@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Keeps only the rows of a headed input whose Column holds Value.
+type columnFilter struct {
+	Column, Value string
+}
+
+// Parses a row filter of the form column=value, e.g. "device=foo".
+func parseColumnFilter(s string) (*columnFilter, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return nil, fmt.Errorf("expected column=value, got %q", s)
+	}
+	return &columnFilter{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])}, nil
+}
+
+// The positions of the fields of a headed input, such as a CSV export from a logging database
+// with many other columns, found from the names in its header row.
+type columnMap struct {
+	Width                           int
+	Physical, Reported, Uncertainty int
+	// The positions of the golden and device columns, or -1 if there are none.
+	Golden, Device int
+	// The position of the column filtered on, or -1 if there is no filter.
+	Filter      int
+	FilterValue string
+	// The names and positions of the metadata columns passed through to Measurement.Meta.
+	MetaNames []string
+	Meta      []int
+}
+
+// Returns the positions of the physical, reported and optional uncertainty, golden and device
+// columns named in header, of the column that filter applies to if it is non-nil, and of the
+// metadata columns named in meta. Column names are matched case insensitively.
+func newColumnMap(header []string, filter *columnFilter, meta []string) (*columnMap, error) {
+	find := func(name string) int {
+		for i, h := range header {
+			if strings.EqualFold(h, name) {
+				return i
+			}
+		}
+		return -1
+	}
+	c := &columnMap{
+		Width:       len(header),
+		Physical:    find("physical"),
+		Reported:    find("reported"),
+		Uncertainty: find("uncertainty"),
+		Golden:      find("golden"),
+		Device:      find("device"),
+		Filter:      -1,
+	}
+	if c.Physical < 0 || c.Reported < 0 {
+		return nil, fmt.Errorf("header %q must name physical and reported columns",
+			strings.Join(header, ","))
+	}
+	if filter != nil {
+		if c.Filter = find(filter.Column); c.Filter < 0 {
+			return nil, fmt.Errorf("unknown filter column %q, expected one of %s", filter.Column,
+				strings.Join(header, ", "))
+		}
+		c.FilterValue = filter.Value
+	}
+	for _, name := range meta {
+		i := find(name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown metadata column %q, expected one of %s", name,
+				strings.Join(header, ", "))
+		}
+		c.MetaNames = append(c.MetaNames, name)
+		c.Meta = append(c.Meta, i)
+	}
+	return c, nil
+}
+
+// Returns the measurement fields of a row in the order parseMeasurement expects, or false if the
+// filter rejects the row.
+func (c *columnMap) Select(fields []string) ([]string, bool, error) {
+	if len(fields) != c.Width {
+		return nil, false, fmt.Errorf("expected %d columns as in the header, got %d", c.Width,
+			len(fields))
+	}
+	if c.Filter >= 0 && fields[c.Filter] != c.FilterValue {
+		return nil, false, nil
+	}
+	selected := []string{fields[c.Physical], fields[c.Reported]}
+	if c.Uncertainty >= 0 {
+		selected = append(selected, fields[c.Uncertainty])
+	}
+	return selected, true, nil
+}
+
+// Reports whether a row is marked as golden, i.e. as coming from a precision rig. Rows are not
+// golden if there is no golden column. The row must have the width of the header.
+func (c *columnMap) IsGolden(fields []string) (bool, error) {
+	if c.Golden < 0 || len(fields) != c.Width {
+		return false, nil
+	}
+	golden, err := strconv.ParseBool(fields[c.Golden])
+	if err != nil {
+		return false, fmt.Errorf("invalid golden value %q, expected true or false", fields[c.Golden])
+	}
+	return golden, nil
+}
+
+// Returns the device a row was captured on, or "" if there is no device column. The row must
+// have the width of the header.
+func (c *columnMap) DeviceOf(fields []string) string {
+	if c.Device < 0 || len(fields) != c.Width {
+		return ""
+	}
+	return fields[c.Device]
+}
+
+// Returns the values of the metadata columns in the row fields keyed by column name, or nil if
+// there are no metadata columns.
+func (c *columnMap) MetaOf(fields []string) map[string]string {
+	if len(c.Meta) == 0 || len(fields) != c.Width {
+		return nil
+	}
+	meta := make(map[string]string, len(c.Meta))
+	for i, col := range c.Meta {
+		meta[c.MetaNames[i]] = fields[col]
+	}
+	return meta
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
+// The number of evenly spaced reported values at which printInputComparison compares the
+// predictions of the two fits.
+const comparisonPoints = 5
+
+// Fits old and cur independently and prints how the winning style, its parameters, its error and
+// its predictions across the combined reported range changed between them, for example between
+// captures before and after a firmware update. The pixel units of each use its own dpi.
+func printInputComparison(old, cur []Measurement, styles []ReportingStyle, opts fitOptions,
+	oldDpi, curDpi float64) {
+	oldResult := findBestResult(fitStyles(old, styles, opts))
+	curResult := findBestResult(fitStyles(cur, styles, opts))
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "\tOld\tNew\tDelta")
+	fmt.Fprintf(tw, "Style\t%s\t%s\n", oldResult.Type, curResult.Type)
+	row := func(name string, o, n float64) {
+		fmt.Fprintf(tw, "%s\t%f\t%f\t%+f\n", name, o, n, n-o)
+	}
+	row("Scale", oldResult.Scale, curResult.Scale)
+	row("Bias", oldResult.Bias, curResult.Bias)
+	row("Error", oldResult.Error, curResult.Error)
+	row("Dpi", oldDpi, curDpi)
+	row("Pixel scale", oldDpi*oldResult.Scale, curDpi*curResult.Scale)
+	row("Pixel bias", oldDpi*oldResult.Bias, curDpi*curResult.Bias)
+	oldRange, curRange := reportedRange(old), reportedRange(cur)
+	lo, hi := math.Min(oldRange.Lo, curRange.Lo), math.Max(oldRange.Hi, curRange.Hi)
+	oldStyle, curStyle := lookupStyle(oldResult.Type), lookupStyle(curResult.Type)
+	for i := 0; i < comparisonPoints; i++ {
+		x := lo + (hi-lo)*float64(i)/(comparisonPoints-1)
+		row(fmt.Sprintf("Physical at %g", x), Predict(oldStyle, oldResult, x),
+			Predict(curStyle, curResult, x))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// A fit of one scale shared by every device and a separate bias for each, for a batch of
+// nominally identical panels that differ only in their offset.
+type deviceFit struct {
+	Type  string
+	Scale float64
+	// The device ids, sorted.
+	Devices []string
+	// The bias of each device, keyed by device id.
+	Biases map[string]float64
+	// The root mean square error over every device's measurements.
+	Error float64
+}
+
+// Fits style to ms with a common scale and a per-device bias, a fixed effects regression: with
+// the weighted means xg and yg of each device g, scale = sum(w * (x - xg) * (y - yg)) /
+// sum(w * (x - xg)^2) over all measurements, and the bias of g is yg - scale * xg. This assumes
+// the devices share the same response shape and noise, differing only by a constant offset.
+// Every device needs at least two measurements.
+func fitDeviceIntercepts(ms []Measurement, style ReportingStyle) (deviceFit, error) {
+	groups := make(map[string][]Measurement)
+	for _, m := range ms {
+		if m.Device == "" {
+			return deviceFit{}, fmt.Errorf("the measurement on %s has no device; headed input "+
+				"with a device column is needed", describeRow(m))
+		}
+		groups[m.Device] = append(groups[m.Device], style.Apply(m))
+	}
+	// Visit the devices in a fixed order so the sums, and any error, are the same on every run.
+	devices := make([]string, 0, len(groups))
+	for device := range groups {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	type means struct{ x, y float64 }
+	avgs := make(map[string]means)
+	num, denom := float64(0), float64(0)
+	for _, device := range devices {
+		group := groups[device]
+		if len(group) < 2 {
+			return deviceFit{}, fmt.Errorf("%w: device %s has %d measurement, need at least 2",
+				ErrInsufficientData, device, len(group))
+		}
+		x, y := weightedMeans(group)
+		avgs[device] = means{x, y}
+		for _, m := range group {
+			dx := m.Reported - x
+			num += m.Weight * dx * (m.Physical - y)
+			denom += m.Weight * dx * dx
+		}
+	}
+	fit := deviceFit{Type: style.Type(), Scale: num / denom, Devices: devices,
+		Biases: make(map[string]float64)}
+	sse := float64(0)
+	for _, device := range devices {
+		group := groups[device]
+		bias := avgs[device].y - fit.Scale*avgs[device].x
+		fit.Biases[device] = bias
+		for _, m := range group {
+			diff := m.Physical - (fit.Scale*m.Reported + bias)
+			sse += diff * diff
+		}
+	}
+	fit.Error = math.Sqrt(sse / float64(len(ms)))
+	return fit, nil
+}
+
+// Prints the shared scale of fit and the bias of each device, in mm and in pixels at dpi.
+func printDeviceFit(fit deviceFit, dpi float64) {
+	fmt.Printf("Shared %s scale=%f (%s px), error=%f\n", fit.Type, fit.Scale,
+		formatScale(dpi*fit.Scale), fit.Error)
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Device\tBias (mm)\tBias (px)")
+	for _, device := range fit.Devices {
+		bias := fit.Biases[device]
+		fmt.Fprintf(tw, "%s\t%f\t%s\n", device, bias, formatBias(dpi*bias))
+	}
+	tw.Flush()
+}
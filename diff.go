@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The number of unchanged lines shown around each change in a unified diff.
+const diffContext = 3
+
+// A line of an edit script turning one file into another: ' ' if it is in both, '-' if it is only
+// in the old file and '+' if it is only in the new one.
+type diffLine struct {
+	Op   byte
+	Text string
+}
+
+// Returns the shortest edit script turning a into b, found from their longest common subsequence.
+// The files compared are idc files of a few dozen lines, so the quadratic table is fine.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var script []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			script = append(script, diffLine{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			script = append(script, diffLine{'-', a[i]})
+			i++
+		default:
+			script = append(script, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return script
+}
+
+// Writes a unified diff turning a, named aName, into b, named bName. Nothing is written if they
+// are the same.
+func writeUnifiedDiff(w io.Writer, aName, bName string, a, b []string) error {
+	script := diffLines(a, b)
+	var out strings.Builder
+	// oldLine and newLine count the lines of a and b before script[k].
+	oldLine, newLine := 0, 0
+	for k := 0; k < len(script); {
+		if script[k].Op == ' ' {
+			oldLine++
+			newLine++
+			k++
+			continue
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+		}
+		// Extend the hunk until diffContext lines past a change with no other change within
+		// 2*diffContext lines of it, so that nearby changes share a hunk.
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for n := k; n < len(script) && n-end <= 2*diffContext; n++ {
+			if script[n].Op != ' ' {
+				end = n
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(script) {
+			stop = len(script)
+		}
+		oldStart, newStart := oldLine-(k-start), newLine-(k-start)
+		oldCount, newCount := 0, 0
+		var body strings.Builder
+		for _, l := range script[start:stop] {
+			if l.Op != '+' {
+				oldCount++
+			}
+			if l.Op != '-' {
+				newCount++
+			}
+			fmt.Fprintf(&body, "%c%s\n", l.Op, l.Text)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n%s", hunkRange(oldStart, oldCount),
+			hunkRange(newStart, newCount), body.String())
+		oldLine += oldCount - (k - start)
+		newLine += newCount - (k - start)
+		k = stop
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// Formats the range of a hunk, given the number of lines before it and its length, the way diff
+// does: an empty range is numbered after the line it follows.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Renders an edit script one op and line per element, e.g. " a", "-b", "+c".
+func scriptString(script []diffLine) string {
+	lines := make([]string, len(script))
+	for i, l := range script {
+		lines[i] = string(l.Op) + l.Text
+	}
+	return strings.Join(lines, ",")
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", ""},
+		{"a b c", "a b c", " a, b, c"},
+		{"", "a b", "+a,+b"},
+		{"a b", "", "-a,-b"},
+		{"a b c", "a x c", " a,-b,+x, c"},
+		{"a b c d", "b d e", "-a, b,-c, d,+e"},
+		// Of the equally long common subsequences "a c" and "b c", ties delete from a first.
+		{"a b c", "b a c", "-a, b,+a, c"},
+	}
+	for _, test := range tests {
+		got := scriptString(diffLines(strings.Fields(test.a), strings.Fields(test.b)))
+		if got != test.want {
+			t.Errorf("diffLines(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	lines := func(n int, change map[int]string) []string {
+		var ls []string
+		for i := 1; i <= n; i++ {
+			l, ok := change[i]
+			if !ok {
+				l = "line" + string(rune('a'+i-1))
+			}
+			if l != "" {
+				ls = append(ls, l)
+			}
+		}
+		return ls
+	}
+	tests := []struct {
+		name string
+		a, b []string
+		want string
+	}{
+		{name: "same", a: lines(5, nil), b: lines(5, nil), want: ""},
+		{name: "one change", a: lines(10, nil), b: lines(10, map[int]string{5: "changed"}),
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n lineb\n" +
+				" linec\n lined\n-linee\n+changed\n linef\n lineg\n lineh\n"},
+		{name: "append to empty", a: nil, b: []string{"x", "y"},
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+x\n+y\n"},
+		{name: "delete the only line", a: []string{"x"}, b: nil,
+			want: "--- old\n+++ new\n@@ -1 +0,0 @@\n-x\n"},
+		{name: "distant changes get separate hunks",
+			a: lines(20, nil), b: lines(20, map[int]string{2: "first", 18: "second"}),
+			want: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,5 @@\n linea\n-lineb\n+first\n linec\n lined\n linee\n" +
+				"@@ -15,6 +15,6 @@\n lineo\n linep\n lineq\n-liner\n+second\n lines\n linet\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := writeUnifiedDiff(&b, "old", "new", test.a, test.b); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", b.String(), test.want)
+			}
+		})
+	}
+}
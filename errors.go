@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by Fit, wrapped with more detail. Test for them with errors.Is.
+var (
+	// There are too few measurements to fit a line.
+	ErrInsufficientData = errors.New("insufficient data")
+	// The measurements don't determine a line, for example because every reported value is the
+	// same.
+	ErrDegenerateInput = errors.New("degenerate input")
+	// The style's transform isn't defined for some of the measurements, for example the square
+	// root of a negative reported value.
+	ErrInapplicableStyle = errors.New("inapplicable style")
+)
+
+// An error in a line of measurement input, as returned by readMeasurements and
+// scanMeasurements. Use errors.As to retrieve it.
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func parseErrorf(line int, format string, args ...interface{}) error {
+	return &ParseError{line, fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The columns holding each field of a fixed width measurement line.
+type fixedWidthSpec struct {
+	Physical, Reported columnSpan
+	// The uncertainty column is optional; its Width is 0 if there isn't one.
+	Uncertainty columnSpan
+}
+
+// A span of characters in a line, starting at the 0-based Start.
+type columnSpan struct {
+	Start, Width int
+}
+
+// Parses a fixed width column spec of comma separated name=start:width fields, where start is
+// the 0-based offset of the column within the line and width its length in characters. The
+// physical and reported columns are required, and an uncertainty column may also be given, e.g.
+// "physical=0:8,reported=10:6,uncertainty=18:5".
+func parseFixedWidthSpec(s string) (*fixedWidthSpec, error) {
+	var spec fixedWidthSpec
+	for _, field := range strings.Split(s, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected name=start:width, got %q", field)
+		}
+		span, err := parseColumnSpan(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", parts[0], err)
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "physical":
+			spec.Physical = span
+		case "reported":
+			spec.Reported = span
+		case "uncertainty":
+			spec.Uncertainty = span
+		default:
+			return nil, fmt.Errorf("unknown column %q, expected physical, reported or uncertainty",
+				parts[0])
+		}
+	}
+	if spec.Physical.Width == 0 || spec.Reported.Width == 0 {
+		return nil, fmt.Errorf("both the physical and reported columns are required")
+	}
+	return &spec, nil
+}
+
+func parseColumnSpan(s string) (columnSpan, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return columnSpan{}, fmt.Errorf("expected start:width, got %q", s)
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return columnSpan{}, err
+	}
+	width, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return columnSpan{}, err
+	}
+	if start < 0 || width <= 0 {
+		return columnSpan{}, fmt.Errorf("start must not be negative and width must be positive")
+	}
+	return columnSpan{start, width}, nil
+}
+
+// Splits a line into its physical, reported and, if the spec has one, uncertainty fields, in
+// the same order that parseMeasurement expects them.
+func (spec *fixedWidthSpec) Fields(line string) ([]string, error) {
+	spans := []columnSpan{spec.Physical, spec.Reported}
+	if spec.Uncertainty.Width > 0 {
+		spans = append(spans, spec.Uncertainty)
+	}
+	fields := make([]string, len(spans))
+	for i, span := range spans {
+		end := span.Start + span.Width
+		if len(line) < end {
+			return nil, fmt.Errorf("line is %d characters long, but a column ends at %d",
+				len(line), end)
+		}
+		fields[i] = strings.TrimSpace(line[span.Start:end])
+	}
+	return fields, nil
+}
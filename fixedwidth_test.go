@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFixedWidthSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want fixedWidthSpec
+		err  string
+	}{
+		{spec: "physical=0:8,reported=10:6",
+			want: fixedWidthSpec{Physical: columnSpan{0, 8}, Reported: columnSpan{10, 6}}},
+		{spec: "reported=10:6, physical = 0:8,uncertainty=18:5",
+			want: fixedWidthSpec{Physical: columnSpan{0, 8}, Reported: columnSpan{10, 6},
+				Uncertainty: columnSpan{18, 5}}},
+		{spec: "physical=0:8", err: "both the physical and reported columns are required"},
+		{spec: "physical=0:8,reported", err: "expected name=start:width"},
+		{spec: "physical=0:8,reported=10", err: "expected start:width"},
+		{spec: "physical=0:8,reported=10:x", err: "invalid syntax"},
+		{spec: "physical=-1:8,reported=10:6", err: "start must not be negative"},
+		{spec: "physical=0:0,reported=10:6", err: "width must be positive"},
+		{spec: "physical=0:8,reported=10:6,weight=18:5", err: "unknown column"},
+	}
+	for _, test := range tests {
+		got, err := parseFixedWidthSpec(test.spec)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseFixedWidthSpec(%q) returned error %v, want one containing %q",
+					test.spec, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseFixedWidthSpec(%q): %v", test.spec, err)
+			continue
+		}
+		if *got != test.want {
+			t.Errorf("parseFixedWidthSpec(%q) = %+v, want %+v", test.spec, *got, test.want)
+		}
+	}
+}
+
+func TestFixedWidthFields(t *testing.T) {
+	spec := &fixedWidthSpec{Physical: columnSpan{0, 6}, Reported: columnSpan{6, 4}}
+	uncertain := &fixedWidthSpec{Physical: columnSpan{0, 6}, Reported: columnSpan{6, 4},
+		Uncertainty: columnSpan{10, 4}}
+	tests := []struct {
+		spec *fixedWidthSpec
+		line string
+		want []string
+		err  string
+	}{
+		{spec: spec, line: "  4.85   6", want: []string{"4.85", "6"}},
+		{spec: spec, line: "4.85  12  trailing", want: []string{"4.85", "12"}},
+		{spec: uncertain, line: "  4.85   6 0.1", want: []string{"4.85", "6", "0.1"}},
+		{spec: spec, line: "  4.85  6", err: "line is 9 characters long, but a column ends at 10"},
+		{spec: uncertain, line: "  4.85   6", err: "a column ends at 14"},
+		{spec: spec, line: "", err: "line is 0 characters long"},
+	}
+	for _, test := range tests {
+		got, err := test.spec.Fields(test.line)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Fields(%q) returned error %v, want one containing %q", test.line, err,
+					test.err)
+			}
+			continue
+		}
+		if err != nil || strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("Fields(%q) = %q, %v, want %q", test.line, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// Returns n measurements of a noisy linear calibration, the same for the same seed.
+func testMeasurements(n int, seed int64) []Measurement {
+	rng := rand.New(rand.NewSource(seed))
+	ms := make([]Measurement, n)
+	for i := range ms {
+		reported := float64(i + 1)
+		ms[i] = Measurement{Physical: 0.75*reported + 0.5 + 0.1*rng.NormFloat64(),
+			Reported: reported, Weight: 1}
+	}
+	return ms
+}
+
+// Returns what fn prints to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		done <- data
+	}()
+	defer func() {
+		os.Stdout = stdout
+	}()
+	fn()
+	w.Close()
+	return string(<-done)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Writes an Android input device configuration (idc) fragment for the touch size calibration c.
+// With -minimal-idc only the touch.size.* keys are written, without any comments.
+func writeIDC(w io.Writer, c calibration) error {
+	var b strings.Builder
+	if !*minimalIDC {
+		fmt.Fprintf(&b, "# Touch size calibration generated by scali\n")
+		writeMeta(&b, "# ")
+		fmt.Fprintf(&b, "# input-sha256: %s\n", measurementsHash(c.Measurements))
+		fmt.Fprintf(&b, "# error: %f mm\n", c.Result.Error)
+		if *weightScheme != "none" {
+			fmt.Fprintf(&b, "# weight-scheme: %s\n", *weightScheme)
+		}
+		if r := getBounds("-trim-range", *trimRange); r != nil {
+			fmt.Fprintf(&b, "# valid for reported sizes from %g to %g\n", r.Lo, r.Hi)
+		}
+	}
+	props := calibrationProperties(c)
+	if *templatePath != "" {
+		// Unlike an idc being updated, a template has to exist.
+		if _, err := os.Stat(*templatePath); err != nil {
+			return fmt.Errorf("-template: %v", err)
+		}
+		lines, err := readIDCLines(*templatePath)
+		if err != nil {
+			return fmt.Errorf("-template: %v", err)
+		}
+		if props = overlayProperties(lines, props); len(props) == 0 {
+			fmt.Fprintf(&b, "# no touch.size.* keys differ from %s\n", *templatePath)
+		}
+	}
+	for _, p := range props {
+		fmt.Fprintf(&b, "%s\n", p)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// The largest difference between numeric idc values that overlayProperties treats as equal. The
+// scale and bias are written with 6 digits after the decimal point by default, so this ignores
+// differences that only come from rounding.
+const idcValueTolerance = 1e-6
+
+// Returns the properties in props whose values differ from those of the same keys in the idc
+// template lines, including any the template doesn't set: the overlay that turns the template
+// into the full calibration. Values that both parse as numbers are compared within
+// idcValueTolerance, others exactly.
+func overlayProperties(lines []string, props []idcProperty) []idcProperty {
+	template := make(map[string]string)
+	for _, line := range lines {
+		if p, ok := parseIDCProperty(line); ok {
+			template[p.Key] = p.Value
+		}
+	}
+	var overlay []idcProperty
+	for _, p := range props {
+		old, ok := template[p.Key]
+		if !ok {
+			overlay = append(overlay, p)
+			continue
+		}
+		a, aerr := strconv.ParseFloat(old, 64)
+		b, berr := strconv.ParseFloat(p.Value, 64)
+		if aerr == nil && berr == nil {
+			if math.Abs(a-b) > idcValueTolerance {
+				overlay = append(overlay, p)
+			}
+		} else if old != p.Value {
+			overlay = append(overlay, p)
+		}
+	}
+	return overlay
+}
+
+// A single "key = value" property of an idc file.
+type idcProperty struct {
+	Key, Value string
+}
+
+func (p idcProperty) String() string {
+	return p.Key + " = " + p.Value
+}
+
+// Returns the touch.size.* properties describing c, in the order they are written.
+func calibrationProperties(c calibration) []idcProperty {
+	props := []idcProperty{
+		{"touch.size.calibration", c.Result.Type},
+		{"touch.size.scale", formatScale(c.Scale())},
+	}
+	if !*scaleOnly {
+		props = append(props, idcProperty{"touch.size.bias", formatBias(c.Bias())})
+	}
+	return props
+}
+
+// Reads the lines of the idc file at path. A file that doesn't exist has no lines.
+func readIDCLines(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// Parses an idc line as a property, reporting false for comments, blank lines and anything else
+// that isn't of the form "key = value".
+func parseIDCProperty(line string) (idcProperty, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return idcProperty{}, false
+	}
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return idcProperty{}, false
+	}
+	return idcProperty{strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])}, true
+}
+
+// Returns a copy of lines with the value of each of props replaced, and any of props that
+// weren't present appended. Every other line, including comments, is kept as is.
+func mergeIDC(lines []string, props []idcProperty) []string {
+	merged := make([]string, len(lines))
+	copy(merged, lines)
+	for _, p := range props {
+		found := false
+		for i, line := range merged {
+			if existing, ok := parseIDCProperty(line); ok && existing.Key == p.Key {
+				merged[i] = p.String()
+				found = true
+			}
+		}
+		if !found {
+			merged = append(merged, p.String())
+		}
+	}
+	return merged
+}
+
+// Prints a unified-diff-style preview of the lines of the idc at path that merging c into it
+// would change. If there's no file at path, every calibration line is shown as an addition.
+func printIDCChanges(path string, c calibration) error {
+	old, err := readIDCLines(path)
+	if err != nil {
+		return err
+	}
+	merged := mergeIDC(old, calibrationProperties(c))
+	// Merging only ever replaces lines in place or appends them, so the files can be compared
+	// line by line.
+	var out strings.Builder
+	for i, line := range merged {
+		if i < len(old) && line == old[i] {
+			continue
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", path, path)
+		}
+		if i < len(old) {
+			fmt.Fprintf(&out, "-%s\n", old[i])
+		}
+		fmt.Fprintf(&out, "+%s\n", line)
+	}
+	if out.Len() == 0 {
+		infof("No changes to %s", path)
+		return nil
+	}
+	_, err = io.WriteString(os.Stdout, out.String())
+	return err
+}
+
+// Prints a unified diff from the idc at path to the idc that would be generated for c, which
+// unlike printIDCChanges also shows changes to the header comments and any other keys.
+func printIDCDiff(path string, c calibration) error {
+	old, err := readIDCLines(path)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if err := writeIDC(&b, c); err != nil {
+		return err
+	}
+	generated := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	return writeUnifiedDiff(os.Stdout, path, path+" (generated)", old, generated)
+}
+
+// Writes an idc for every idc compatible result that could be fit into dir, named after its
+// style type, so that each style can be tried on the device.
+func writeAllIDCs(dir string, results []OptimizationResult, dpi float64, ms []Measurement) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if math.IsNaN(r.Error) || !lookupStyle(r.Type).IdcCompatible() {
+			continue
+		}
+		path := filepath.Join(dir, r.Type+".idc")
+		if err := emitCalibration(path, "idc", calibration{r, dpi, ms, nil, fitOptions{}}); err != nil {
+			return err
+		}
+		infof("Wrote %s", path)
+	}
+	return nil
+}
+
+// Returns a hex encoded SHA-256 of the measurements, so a generated idc can be traced back to
+// the dataset that produced it. The measurements are hashed in sorted order so that reordering
+// the input does not change the result.
+func measurementsHash(ms []Measurement) string {
+	sorted := make([]Measurement, len(ms))
+	copy(sorted, ms)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Reported != sorted[j].Reported {
+			return sorted[i].Reported < sorted[j].Reported
+		}
+		return sorted[i].Physical < sorted[j].Physical
+	})
+	h := sha256.New()
+	for _, m := range sorted {
+		fmt.Fprintf(h, "%s %s\n",
+			strconv.FormatFloat(m.Physical, 'g', -1, 64),
+			strconv.FormatFloat(m.Reported, 'g', -1, 64))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// How many times the error of the fit scali would produce an existing idc's error has to be for
+// -sanity-check to flag the idc as stale or hand edited.
+const staleIDCFactor = 2
+
+// Reconstructs the calibration in the touch.size.* keys of the idc at path as a result in mm,
+// converting its pixel scale and bias with dpi. A missing bias is zero, as it is on the device.
+func readIDCCalibration(path string, dpi float64) (OptimizationResult, error) {
+	if _, err := os.Stat(path); err != nil {
+		return OptimizationResult{}, err
+	}
+	lines, err := readIDCLines(path)
+	if err != nil {
+		return OptimizationResult{}, err
+	}
+	values := make(map[string]string)
+	for _, line := range lines {
+		if p, ok := parseIDCProperty(line); ok {
+			values[p.Key] = p.Value
+		}
+	}
+	t, ok := values["touch.size.calibration"]
+	if !ok {
+		return OptimizationResult{}, fmt.Errorf("%s sets no touch.size.calibration", path)
+	}
+	if style := lookupStyle(t); style == nil || !style.IdcCompatible() {
+		return OptimizationResult{}, fmt.Errorf("%s: unknown touch.size.calibration %q", path, t)
+	}
+	r := OptimizationResult{Type: t, ScaleStdErr: math.NaN()}
+	s, ok := values["touch.size.scale"]
+	if !ok {
+		return OptimizationResult{}, fmt.Errorf("%s sets no touch.size.scale", path)
+	}
+	scale, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return OptimizationResult{}, fmt.Errorf("%s: invalid touch.size.scale: %v", path, err)
+	}
+	r.Scale = scale / dpi
+	if s, ok := values["touch.size.bias"]; ok {
+		bias, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return OptimizationResult{}, fmt.Errorf("%s: invalid touch.size.bias: %v", path, err)
+		}
+		r.Bias = bias / dpi
+	}
+	return r, nil
+}
+
+// Applies the calibration in the idc at path to ms and prints its error beside that of fitted,
+// the calibration scali would write, flagging the idc if it is staleIDCFactor times worse.
+func printSanityCheck(path string, ms []Measurement, fitted OptimizationResult, dpi float64) error {
+	r, err := readIDCCalibration(path, dpi)
+	if err != nil {
+		return err
+	}
+	style := lookupStyle(r.Type)
+	sum := 0.0
+	for _, m := range ms {
+		diff := m.Physical - Predict(style, r, m.Reported)
+		sum += diff * diff
+	}
+	r.Error = math.Sqrt(sum / float64(len(ms)))
+	fmt.Printf("%s: %s with scale %f mm, bias %f mm has an error of %f mm\n", path, r.Type,
+		r.Scale, r.Bias, r.Error)
+	fmt.Printf("Fitting the measurements gives %s with an error of %f mm\n", fitted.Type,
+		fitted.Error)
+	if r.Error > staleIDCFactor*fitted.Error+idcValueTolerance {
+		warnOrFail("%s is %.1f times worse than a fresh fit; it may be stale or hand edited",
+			path, r.Error/fitted.Error)
+	}
+	return nil
+}
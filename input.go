@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type parseOptions struct {
+	// A constant pedestal subtracted from every reported value as it is read, before any
+	// reporting style is applied. Unlike the fitted bias, which is in physical units (mm), this
+	// is in the same unit-less units as the kernel's ABS_MT_TOUCH_MAJOR.
+	ReportedOffset float64
+	// If non-nil, measurements whose reported value, as written in the input, falls within this
+	// range are skipped.
+	ExcludeReported *valueRange
+	// If non-nil, fields are taken from fixed columns of each line rather than split on
+	// whitespace and commas.
+	FixedWidth *fixedWidthSpec
+	// If set, the first line of the input is a header naming its columns, which must include
+	// physical and reported columns and may include uncertainty and golden columns.
+	Header bool
+	// If non-nil, only the rows of a headed input matching the filter are read.
+	Filter *columnFilter
+	// The columns of a headed input to keep as metadata on each measurement.
+	MetaColumns []string
+	// If positive, readMeasurements stops after this many measurements. scanMeasurements
+	// ignores it, since it doesn't keep the measurements.
+	MaxMeasurements int
+	// Weight measurements whose physical size is a bracket by the inverse of the variance of a
+	// uniform distribution over it, so that narrower brackets count for more.
+	BracketWeights bool
+	// If set, each line holds a physical size followed by any number of reported values, the
+	// trials at that size, each read as a measurement.
+	Wide bool
+	// Record the numbers that don't round-trip, as checked by roundTrips, in inputStats.
+	StrictFloat bool
+}
+
+// Counts of what happened while parsing an input.
+type inputStats struct {
+	// The number of measurements skipped by #exclude-start/#exclude-end or -exclude.
+	Excluded int
+	// The number of rows skipped by the filter.
+	Filtered int
+	// Whether reading stopped at the MaxMeasurements limit before the end of the input.
+	Truncated bool
+	// The dots per mm set by a #!dpi directive, or 0 if there wasn't one.
+	Dpi float64
+	// The names of directives that weren't recognized, which are otherwise ignored.
+	UnknownDirectives []string
+	// With StrictFloat, a description of each number in the input that lost precision on parse.
+	LossyFloats []string
+	// The number of measurements whose reported value the ReportedOffset made negative.
+	NegativeReported int
+}
+
+// The units physical sizes may be given in with a #!units directive, as the number of mm in each.
+var physicalUnits = map[string]float64{
+	"mm": 1,
+	"cm": 10,
+	"in": 25.4,
+}
+
+// Reads measurements from r. Each line holds the physical size of the touch in mm followed by
+// the reported size, separated by whitespace or a comma. Blank lines and lines starting with
+// '#' are ignored. Errors in the input are returned as a *ParseError.
+//
+// A line of three or more dashes, such as "---", starts a new section. This allows a single
+// file to hold, say, a coarse sweep followed by a fine one, which can then be weighted or
+// filtered separately. Measurements before the first marker are in section 1.
+//
+// Rows between "#exclude-start" and "#exclude-end" comment lines are skipped, which keeps
+// known-bad parts of a capture in the file without fitting them.
+//
+// Physical sizes may carry an uncertainty (one standard deviation, in mm), written either as
+// "6.9 ± 0.2 8" or as a third column, "6.9 8 0.2". Measurements are then weighted by the inverse
+// of their variance, 1/σ². Either every measurement has an uncertainty or none do.
+//
+// The physical size may instead be a "min-max" bracket, as in "4.5-5.2 6", for protocols that
+// bracket the contact rather than measure it. The midpoint of the bracket is fitted, and with
+// bracket weighting its width sets the measurement's uncertainty.
+//
+// Lines starting with "#!" before the first measurement are directives that make a file describe
+// its own calibration run:
+//
+//	#!dpi 18.3   the dots per mm of the panel, unless -dpi is given
+//	#!units in   the unit of the physical sizes and uncertainties: mm (the default), cm or in
+//
+// With a header, the input instead starts with a row naming its columns, for example a CSV export
+// holding the captures of several devices, and a filter can select the rows that are read. A
+// golden column marks the measurements taken on a precision rig, and a device column the device
+// each measurement was captured on.
+func readMeasurements(r io.Reader, opts parseOptions) ([]Measurement, inputStats, error) {
+	var ms []Measurement
+	stats, err := scanMeasurements(r, opts, func(m Measurement) error {
+		if opts.MaxMeasurements > 0 && len(ms) == opts.MaxMeasurements {
+			return errTruncated
+		}
+		ms = append(ms, m)
+		return nil
+	})
+	if errors.Is(err, errTruncated) {
+		stats.Truncated = true
+		err = nil
+	}
+	if err != nil {
+		return nil, stats, err
+	}
+	return ms, stats, nil
+}
+
+// Stops readMeasurements at the MaxMeasurements limit.
+var errTruncated = errors.New("too many measurements")
+
+// Like readMeasurements, but calls fn with each measurement as soon as its line has been read
+// rather than collecting them, so that r may be an unbounded stream such as a FIFO. Scanning
+// stops at the first error returned by fn.
+func scanMeasurements(r io.Reader, opts parseOptions, fn func(Measurement) error) (inputStats, error) {
+	var stats inputStats
+	scanner := newLineScanner(r)
+	measured, uncertain := 0, 0
+	section := 1
+	excludeStart := 0
+	var columns *columnMap
+	unit := float64(1)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		rawLine := scanner.Text()
+		line := strings.TrimSpace(rawLine)
+		switch {
+		case line == "#exclude-start":
+			if excludeStart != 0 {
+				return stats, parseErrorf(lineNum, "#exclude-start inside the region started on line %d",
+					excludeStart)
+			}
+			excludeStart = lineNum
+			continue
+		case line == "#exclude-end":
+			if excludeStart == 0 {
+				return stats, parseErrorf(lineNum, "#exclude-end without #exclude-start")
+			}
+			excludeStart = 0
+			continue
+		case strings.HasPrefix(line, "#!") && measured == 0:
+			if err := applyDirective(line, &stats, &unit); err != nil {
+				return stats, &ParseError{lineNum, err}
+			}
+			continue
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		}
+		if opts.Header && columns == nil {
+			var err error
+			if columns, err = newColumnMap(splitFields(line), opts.Filter, opts.MetaColumns); err != nil {
+				return stats, &ParseError{lineNum, err}
+			}
+			continue
+		}
+		if isSectionMarker(line) {
+			if measured > 0 {
+				section++
+			}
+			continue
+		}
+		if excludeStart != 0 {
+			stats.Excluded++
+			continue
+		}
+		fields := splitFields(strings.Replace(line, "±", " ± ", 1))
+		if opts.FixedWidth != nil {
+			var err error
+			if fields, err = opts.FixedWidth.Fields(rawLine); err != nil {
+				return stats, &ParseError{lineNum, err}
+			}
+		}
+		golden, device := false, ""
+		var meta map[string]string
+		if columns != nil {
+			device = columns.DeviceOf(fields)
+			meta = columns.MetaOf(fields)
+			var keep bool
+			var err error
+			if golden, err = columns.IsGolden(fields); err != nil {
+				return stats, &ParseError{lineNum, err}
+			}
+			if fields, keep, err = columns.Select(fields); err != nil {
+				return stats, &ParseError{lineNum, err}
+			}
+			if !keep {
+				stats.Filtered++
+				continue
+			}
+		}
+		rows := [][]string{fields}
+		if opts.Wide {
+			if len(fields) < 2 {
+				return stats, parseErrorf(lineNum, "expected a physical size and reported trials, got %q",
+					strings.Join(fields, " "))
+			}
+			rows = nil
+			for _, trial := range fields[1:] {
+				rows = append(rows, []string{fields[0], trial})
+			}
+		}
+		for _, row := range rows {
+			m, hasUncertainty, err := parseMeasurement(row, opts.BracketWeights)
+			if err != nil {
+				return stats, &ParseError{lineNum, err}
+			}
+			if opts.StrictFloat {
+				for _, tok := range numberTokens(row) {
+					if v, err := parseNumber(tok); err == nil && !roundTrips(tok, v) {
+						stats.LossyFloats = append(stats.LossyFloats, fmt.Sprintf("line %d: %s was "+
+							"read as %s", lineNum, tok, strconv.FormatFloat(v, 'g', -1, 64)))
+					}
+				}
+			}
+			m.Golden = golden
+			m.Device = device
+			m.Meta = meta
+			if opts.ExcludeReported != nil && opts.ExcludeReported.Contains(m.Reported) {
+				stats.Excluded++
+				continue
+			}
+			m.Reported -= opts.ReportedOffset
+			m.Physical *= unit
+			if hasUncertainty {
+				// An uncertainty or bracket width is in the input's units too. An implicit
+				// weight of 1 stays 1 so unweighted input stays unweighted.
+				m.Weight /= unit * unit
+			}
+			m.Section = section
+			m.Line = lineNum
+			measured++
+			if hasUncertainty {
+				uncertain++
+			}
+			if uncertain != 0 && uncertain != measured {
+				return stats, parseErrorf(lineNum, "either every measurement or none must have an uncertainty")
+			}
+			if err := fn(m); err != nil {
+				return stats, &ParseError{lineNum, err}
+			}
+			if opts.ReportedOffset != 0 && m.Reported < 0 {
+				stats.NegativeReported++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, err
+	}
+	if excludeStart != 0 {
+		return stats, parseErrorf(excludeStart, "#exclude-start is never ended")
+	}
+	return stats, nil
+}
+
+// Applies the "#!name value" directive line, recording a #!dpi in stats and setting unit to the
+// mm per physical unit given by #!units. Unknown directives are recorded in stats.
+func applyDirective(line string, stats *inputStats, unit *float64) error {
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return fmt.Errorf("empty directive")
+	}
+	name := fields[0]
+	switch name {
+	case "dpi", "units":
+		if len(fields) != 2 {
+			return fmt.Errorf("#!%s directive needs exactly one value, got %d", name, len(fields)-1)
+		}
+	default:
+		stats.UnknownDirectives = append(stats.UnknownDirectives, name)
+		return nil
+	}
+	if name == "dpi" {
+		dpi, err := parseNumber(fields[1])
+		if err != nil || dpi <= 0 {
+			return fmt.Errorf("#!dpi must be a positive number, got %q", fields[1])
+		}
+		stats.Dpi = dpi
+		return nil
+	}
+	mm, ok := physicalUnits[fields[1]]
+	if !ok {
+		return fmt.Errorf("unknown #!units %q, expected mm, cm or in", fields[1])
+	}
+	*unit = mm
+	return nil
+}
+
+// Returns a scanner over the lines of r that, unlike bufio.ScanLines, also accepts the lone '\r'
+// line endings of old Mac files and drops a UTF-8 byte order mark at the start of the input, as
+// written by spreadsheet exports. Windows "\r\n" endings are accepted too.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	first := true
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if first {
+			if len(data) < len(utf8BOM) && !atEOF && bytes.HasPrefix(utf8BOM, data) {
+				return 0, nil, nil
+			}
+			first = false
+			if bytes.HasPrefix(data, utf8BOM) {
+				return len(utf8BOM), nil, nil
+			}
+		}
+		if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+			if data[i] == '\n' {
+				return i + 1, data[:i], nil
+			}
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				return i + 1, data[:i], nil
+			}
+			if atEOF {
+				return i + 1, data[:i], nil
+			}
+			// Wait to see whether the '\r' starts a "\r\n".
+			return 0, nil, nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	return scanner
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Parses the fields of a single measurement line, reporting whether it included an uncertainty.
+// With bracketWeights, a physical size given as a bracket counts as an uncertainty.
+func parseMeasurement(fields []string, bracketWeights bool) (Measurement, bool, error) {
+	var physicalField, reportedField, uncertaintyField string
+	switch {
+	case len(fields) == 4 && fields[1] == "±":
+		physicalField, uncertaintyField, reportedField = fields[0], fields[2], fields[3]
+	case len(fields) == 3:
+		physicalField, reportedField, uncertaintyField = fields[0], fields[1], fields[2]
+	case len(fields) == 2:
+		physicalField, reportedField = fields[0], fields[1]
+	default:
+		return Measurement{}, false, fmt.Errorf("expected physical and reported values, got %q",
+			strings.Join(fields, " "))
+	}
+	physical, width, bracketed, err := parsePhysical(physicalField)
+	if err != nil {
+		return Measurement{}, false, fmt.Errorf("invalid physical size: %v", err)
+	}
+	reported, err := parseNumber(reportedField)
+	if err != nil {
+		return Measurement{}, false, fmt.Errorf("invalid reported size: %v", err)
+	}
+	m := Measurement{Physical: physical, Reported: reported, Weight: 1}
+	if bracketed && uncertaintyField != "" {
+		return Measurement{}, false, fmt.Errorf("a physical bracket cannot also have an uncertainty")
+	}
+	if bracketed && bracketWeights {
+		if width == 0 {
+			return Measurement{}, false, fmt.Errorf("cannot weight the zero width bracket %s",
+				physicalField)
+		}
+		// Treat the true size as uniformly distributed within the bracket, whose variance is
+		// width²/12.
+		m.Weight = 12 / (width * width)
+		return m, true, nil
+	}
+	if uncertaintyField == "" {
+		return m, false, nil
+	}
+	sigma, err := parseNumber(uncertaintyField)
+	if err != nil {
+		return Measurement{}, false, fmt.Errorf("invalid uncertainty: %v", err)
+	}
+	if sigma <= 0 {
+		// A zero uncertainty would give the measurement infinite weight.
+		return Measurement{}, false, fmt.Errorf("uncertainty must be positive, got %g", sigma)
+	}
+	m.Weight = 1 / (sigma * sigma)
+	return m, true, nil
+}
+
+// Parses a physical size, which is either a number or a "min-max" bracket such as "4.5-5.2".
+// A bracket is reported along with its width, and stands for its midpoint.
+func parsePhysical(s string) (value, width float64, bracketed bool, err error) {
+	sep := bracketSeparator(s)
+	if sep < 0 {
+		value, err = parseNumber(s)
+		return value, 0, false, err
+	}
+	lo, err := parseNumber(s[:sep])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	hi, err := parseNumber(s[sep+1:])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if lo > hi {
+		return 0, 0, false, fmt.Errorf("bracket %s is inverted: min %g is greater than max %g", s, lo,
+			hi)
+	}
+	return (lo + hi) / 2, hi - lo, true, nil
+}
+
+// Returns the index of the "-" separating the ends of the bracket s, or -1 if it isn't a bracket.
+func bracketSeparator(s string) int {
+	// Skip a leading sign, and the sign of an exponent, when looking for the separator.
+	for i := 1; i < len(s); i++ {
+		if s[i] == '-' && s[i-1] != 'e' && s[i-1] != 'E' {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the numbers written in the fields of a measurement, with both ends of a bracket.
+func numberTokens(fields []string) []string {
+	var toks []string
+	for _, f := range fields {
+		if f == "±" {
+			continue
+		}
+		if sep := bracketSeparator(f); sep >= 0 {
+			toks = append(toks, f[:sep], f[sep+1:])
+		} else {
+			toks = append(toks, f)
+		}
+	}
+	return toks
+}
+
+// Reports whether v, parsed from the decimal tok, is exactly the number tok denotes once written
+// back out in the shortest form that parses to v. This ignores the usual binary approximation of
+// a decimal such as 0.1, which round-trips, and catches tokens with more significant digits than
+// a float64 holds, or too large or small a magnitude, whose value changed on parse.
+func roundTrips(tok string, v float64) bool {
+	want, ok := new(big.Rat).SetString(tok)
+	if !ok {
+		// Not a decimal, such as a hexadecimal float, which parses exactly or not at all.
+		return true
+	}
+	got, _ := new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+	return want.Cmp(got) == 0
+}
+
+// Reads one float per line from r, ignoring blank lines and lines starting with '#'.
+func readValues(r io.Reader) ([]float64, error) {
+	var vals []float64
+	scanner := newLineScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		val, err := parseNumber(line)
+		if err != nil {
+			return nil, &ParseError{lineNum, err}
+		}
+		vals = append(vals, val)
+	}
+	return vals, scanner.Err()
+}
+
+func isSectionMarker(line string) bool {
+	return len(line) >= 3 && strings.Trim(line, "-") == ""
+}
+
+// Returns the measurements of ms whose section is one of the given sections.
+func filterSections(ms []Measurement, sections []float64) []Measurement {
+	var kept []Measurement
+	for _, m := range ms {
+		for _, s := range sections {
+			if float64(m.Section) == s {
+				kept = append(kept, m)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// Multiplies the weight of each measurement in section i by factors[i-1]. Sections beyond the
+// end of factors are left unchanged.
+func weightSections(ms []Measurement, factors []float64) {
+	for i := range ms {
+		if s := ms[i].Section; s >= 1 && s <= len(factors) {
+			ms[i].Weight *= factors[s-1]
+		}
+	}
+}
+
+// Parses an integer, decimal or scientific notation number such as "6", "6.9" or "1.4e1".
+// Unlike strconv.ParseFloat, NaN and infinite values are rejected since they can't be fit.
+func parseNumber(s string) (float64, error) {
+	val, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", s)
+	}
+	return val, nil
+}
+
+// Divides the reported range of ms into n equal width bins and returns one measurement per
+// non-empty bin, at the weighted mean reported and physical size of the measurements in it. Each
+// bin's weight is the total weight of its measurements, so a bin of ten unit weight measurements
+// counts ten times as much as a single one.
+func binMeasurements(ms []Measurement, n int) []Measurement {
+	r := reportedRange(ms)
+	width := (r.Hi - r.Lo) / float64(n)
+	bins := make([]Measurement, n)
+	for _, m := range ms {
+		i := 0
+		if width > 0 {
+			i = int((m.Reported - r.Lo) / width)
+		}
+		if i >= n {
+			// The largest reported value lands exactly on the upper edge.
+			i = n - 1
+		}
+		bins[i].Reported += m.Weight * m.Reported
+		bins[i].Physical += m.Weight * m.Physical
+		bins[i].Weight += m.Weight
+	}
+	var binned []Measurement
+	for _, b := range bins {
+		if b.Weight == 0 {
+			continue
+		}
+		b.Reported /= b.Weight
+		b.Physical /= b.Weight
+		binned = append(binned, b)
+	}
+	return binned
+}
+
+func splitFields(line string) []string {
+	return strings.FieldsFunc(line, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
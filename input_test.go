@@ -0,0 +1,175 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"6", 6, true},
+		{"-3", -3, true},
+		{"6.9", 6.9, true},
+		{".5", 0.5, true},
+		{"1.4e1", 14, true},
+		{"2E-3", 0.002, true},
+		{"-1.5e+2", -150, true},
+		{"NaN", 0, false},
+		{"nan", 0, false},
+		{"Inf", 0, false},
+		{"-Inf", 0, false},
+		{"+infinity", 0, false},
+		{"1e400", 0, false},
+		{"six", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseNumber(test.in)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("parseNumber(%q) = %g, want an error", test.in, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseNumber(%q) = %g, %v, want %g", test.in, got, err, test.want)
+		}
+	}
+}
+
+// Every field, not just the first, must accept each number form and reject NaN and Inf.
+func TestReadMeasurementsNumberForms(t *testing.T) {
+	input := "6 8\n6.9, 8.5\n1.4e1 2.5E1\n"
+	ms, _, err := readMeasurements(strings.NewReader(input), parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]float64{{6, 8}, {6.9, 8.5}, {14, 25}}
+	if len(ms) != len(want) {
+		t.Fatalf("read %d measurements, want %d", len(ms), len(want))
+	}
+	for i, m := range ms {
+		if math.Abs(m.Physical-want[i][0]) > 1e-12 || math.Abs(m.Reported-want[i][1]) > 1e-12 {
+			t.Errorf("measurement %d is %g %g, want %g %g", i, m.Physical, m.Reported, want[i][0],
+				want[i][1])
+		}
+	}
+	for _, line := range []string{"NaN 8", "6 NaN", "Inf 8", "6 -Inf", "6 8 ± NaN"} {
+		if _, _, err := readMeasurements(strings.NewReader(line+"\n"), parseOptions{}); err == nil {
+			t.Errorf("reading %q succeeded, want an error", line)
+		}
+	}
+}
+
+// An Excel export with a UTF-8 byte order mark and CRLF line endings, whose BOM would otherwise
+// corrupt the first header name and whose '\r' the last field of each line.
+func TestReadMeasurementsCRLFBOM(t *testing.T) {
+	f, err := os.Open("testdata/crlf_bom.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ms, _, err := readMeasurements(f, parseOptions{Header: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]float64{{4.85, 6}, {6.9, 8}, {9.5, 12}}
+	if len(ms) != len(want) {
+		t.Fatalf("read %d measurements, want %d", len(ms), len(want))
+	}
+	for i, m := range ms {
+		if m.Physical != want[i][0] || m.Reported != want[i][1] {
+			t.Errorf("measurement %d is %g %g, want %g %g", i, m.Physical, m.Reported, want[i][0],
+				want[i][1])
+		}
+	}
+}
+
+func TestReadMeasurementsStructure(t *testing.T) {
+	type point struct {
+		physical, reported float64
+		section            int
+	}
+	tests := []struct {
+		name     string
+		input    string
+		opts     parseOptions
+		want     []point
+		excluded int
+		err      string
+	}{
+		{name: "sections", input: "---\n4 6\n---\n5 8\n6 10\n-----\n7 12\n",
+			want: []point{{4, 6, 1}, {5, 8, 2}, {6, 10, 2}, {7, 12, 3}}},
+		{name: "short dashes aren't a marker", input: "4 6\n--\n", err: "expected physical and reported"},
+		{name: "exclude region",
+			input: "4 6\n#exclude-start\n5 8\n6 10\n#exclude-end\n7 12\n",
+			want:  []point{{4, 6, 1}, {7, 12, 1}}, excluded: 2},
+		{name: "unended exclude region", input: "4 6\n#exclude-start\n5 8\n",
+			err: "line 2: #exclude-start is never ended"},
+		{name: "nested exclude region", input: "#exclude-start\n#exclude-start\n",
+			err: "line 2: #exclude-start inside the region started on line 1"},
+		{name: "exclude end alone", input: "4 6\n#exclude-end\n",
+			err: "line 2: #exclude-end without #exclude-start"},
+		{name: "wide", input: "4 6 7 5\n5, 8\n", opts: parseOptions{Wide: true},
+			want: []point{{4, 6, 1}, {4, 7, 1}, {4, 5, 1}, {5, 8, 1}}},
+		{name: "wide without trials", input: "4\n", opts: parseOptions{Wide: true},
+			err: "expected a physical size and reported trials"},
+		{name: "bracket", input: "4.5-5.5 6\n-1-1 2\n1e-1-3e-1 4\n",
+			want: []point{{5, 6, 1}, {0, 2, 1}, {0.2, 4, 1}}},
+		{name: "inverted bracket", input: "5.5-4.5 6\n", err: "bracket 5.5-4.5 is inverted"},
+		{name: "bracket with uncertainty", input: "4.5-5.5 6 0.1\n",
+			err: "a physical bracket cannot also have an uncertainty"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ms, stats, err := readMeasurements(strings.NewReader(test.input), test.opts)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Excluded != test.excluded {
+				t.Errorf("excluded %d measurements, want %d", stats.Excluded, test.excluded)
+			}
+			if len(ms) != len(test.want) {
+				t.Fatalf("read %d measurements, want %d", len(ms), len(test.want))
+			}
+			for i, m := range ms {
+				w := test.want[i]
+				if math.Abs(m.Physical-w.physical) > 1e-12 || m.Reported != w.reported ||
+					m.Section != w.section {
+					t.Errorf("measurement %d is %g %g in section %d, want %g %g in section %d", i,
+						m.Physical, m.Reported, m.Section, w.physical, w.reported, w.section)
+				}
+			}
+		})
+	}
+}
+
+func TestBracketWeights(t *testing.T) {
+	ms, _, err := readMeasurements(strings.NewReader("4-5 6\n4.5-4.75 8\n"),
+		parseOptions{BracketWeights: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A bracket of width w weighs 12 / w².
+	for i, want := range []float64{12, 192} {
+		if math.Abs(ms[i].Weight-want) > 1e-9 {
+			t.Errorf("measurement %d weighs %g, want %g", i, ms[i].Weight, want)
+		}
+	}
+	_, _, err = readMeasurements(strings.NewReader("5-5 6\n"), parseOptions{BracketWeights: true})
+	if err == nil || !strings.Contains(err.Error(), "zero width bracket") {
+		t.Errorf("got error %v for a zero width bracket, want one naming it", err)
+	}
+}
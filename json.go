@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+)
+
+// The structure written by the json format and returned by the -serve endpoint.
+type jsonCalibration struct {
+	// The winning style, with its scale and bias in mm.
+	Type  string  `json:"type"`
+	Scale float64 `json:"scale"`
+	Bias  float64 `json:"bias"`
+	Error float64 `json:"error"`
+	// The dpi used to convert the scale and bias to pixels.
+	Dpi        float64 `json:"dpi"`
+	PixelScale float64 `json:"pixelScale"`
+	PixelBias  float64 `json:"pixelBias"`
+	// With -covariance, the covariance matrix of the scale and bias in mm, in that order.
+	Covariance *[2][2]float64 `json:"covariance,omitempty"`
+	// The scale and bias again, grouped by the space they're in so that neither set can be
+	// mistaken for the other:
+	//
+	//	"parameters": {
+	//	  "mm":     {"scale": <mm per reported unit>, "bias": <mm>},
+	//	  "dpi":    <pixels per mm>,
+	//	  "pixels": {"scale": <mm scale * dpi>, "bias": <mm bias * dpi>}
+	//	}
+	//
+	// The pixel values are the ones written to an idc file.
+	Parameters jsonParameters `json:"parameters"`
+	// With -keep-all, the full result of every style that could be fit, whether or not it won.
+	Styles []keptResult `json:"styles,omitempty"`
+	// With -compare-all-metrics, the style that wins under each selection rule.
+	SelectionSensitivity *jsonSelectionSensitivity `json:"selectionSensitivity,omitempty"`
+	// With -meta-cols, the measurements with their metadata.
+	Points []jsonPoint `json:"points,omitempty"`
+}
+
+type jsonParameters struct {
+	MM     jsonCoefficients `json:"mm"`
+	Dpi    float64          `json:"dpi"`
+	Pixels jsonCoefficients `json:"pixels"`
+}
+
+// The full result of fitting a style, as recorded by -keep-all. The confidence intervals are
+// omitted when there are too few measurements to estimate them.
+type keptResult struct {
+	Type     string      `json:"type"`
+	Scale    float64     `json:"scale"`
+	Bias     float64     `json:"bias"`
+	Error    float64     `json:"error"`
+	R2       float64     `json:"r2"`
+	ScaleCI  *[2]float64 `json:"scaleCI,omitempty"`
+	BiasCI   *[2]float64 `json:"biasCI,omitempty"`
+	Selected bool        `json:"selected"`
+}
+
+// Returns the full result of each of results that could be fit to ms, with confidence intervals
+// at the 1-significanceLevel level, marking the one of type selected.
+func keptResults(results []OptimizationResult, ms []Measurement, selected string) []keptResult {
+	var kept []keptResult
+	for _, r := range results {
+		if math.IsNaN(r.Error) {
+			continue
+		}
+		stats := computeStats(lookupStyle(r.Type), r, ms)
+		k := keptResult{Type: r.Type, Scale: r.Scale, Bias: r.Bias, Error: r.Error, R2: stats.R2,
+			Selected: r.Type == selected}
+		if len(ms) > 2 {
+			t := studentTCritical(significanceLevel, float64(len(ms)-2))
+			k.ScaleCI = &[2]float64{r.Scale - t*stats.ScaleStdErr, r.Scale + t*stats.ScaleStdErr}
+			k.BiasCI = &[2]float64{r.Bias - t*stats.BiasStdErr, r.Bias + t*stats.BiasStdErr}
+		}
+		kept = append(kept, k)
+	}
+	return kept
+}
+
+// The winner under each of the selectionRules, keyed by rule. Unanimous is false when the rules
+// disagree, in which case the choice of style deserves review.
+type jsonSelectionSensitivity struct {
+	Winners   map[string]string `json:"winners"`
+	Unanimous bool              `json:"unanimous"`
+}
+
+type jsonPoint struct {
+	Physical float64           `json:"physical"`
+	Reported float64           `json:"reported"`
+	Line     int               `json:"line,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+}
+
+type jsonCoefficients struct {
+	Scale float64 `json:"scale"`
+	Bias  float64 `json:"bias"`
+}
+
+func newJSONCalibration(c calibration) jsonCalibration {
+	jc := jsonCalibration{
+		Type:       c.Result.Type,
+		Scale:      c.Result.Scale,
+		Bias:       c.Result.Bias,
+		Error:      c.Result.Error,
+		Dpi:        c.Dpi,
+		PixelScale: c.Scale(),
+		PixelBias:  c.Bias(),
+		Parameters: jsonParameters{
+			MM:     jsonCoefficients{c.Result.Scale, c.Result.Bias},
+			Dpi:    c.Dpi,
+			Pixels: jsonCoefficients{c.Scale(), c.Bias()},
+		},
+	}
+	if *covarianceFlag && len(c.Measurements) > 2 {
+		cov := covariance(lookupStyle(c.Result.Type), c.Result, c.Measurements)
+		jc.Covariance = &cov
+	}
+	if *keepAll {
+		jc.Styles = keptResults(c.Results, c.Measurements, c.Result.Type)
+	}
+	if *compareAllMetrics && c.Results != nil {
+		winners := selectionWinners(c.Results, c.Measurements, c.Options)
+		jc.SelectionSensitivity = &jsonSelectionSensitivity{winners, unanimous(winners)}
+	}
+	if *metaCols != "" {
+		for _, m := range c.Measurements {
+			jc.Points = append(jc.Points, jsonPoint{m.Physical, m.Reported, m.Line, m.Meta})
+		}
+	}
+	return jc
+}
+
+func writeJSON(w io.Writer, c calibration) error {
+	return encodeJSON(w, newJSONCalibration(c))
+}
+
+func encodeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+// The parameters object must group the scale and bias by the space they're in, as documented on
+// jsonCalibration.Parameters.
+func TestWriteJSONParameters(t *testing.T) {
+	c := calibration{Result: OptimizationResult{Type: "diameter", Scale: 2, Bias: 1}, Dpi: 10}
+	var b strings.Builder
+	if err := writeJSON(&b, c); err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal([]byte(b.String()), &out); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, b.String())
+	}
+	params, ok := out["parameters"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("no parameters object in\n%s", b.String())
+	}
+	if len(params) != 3 {
+		t.Errorf("parameters has keys %v, want mm, dpi and pixels", params)
+	}
+	if dpi, ok := params["dpi"].(float64); !ok || dpi != 10 {
+		t.Errorf("parameters.dpi = %v, want 10", params["dpi"])
+	}
+	for space, want := range map[string][2]float64{"mm": {2, 1}, "pixels": {20, 10}} {
+		coefficients, ok := params[space].(map[string]interface{})
+		if !ok {
+			t.Errorf("parameters.%s is %v, want an object", space, params[space])
+			continue
+		}
+		if len(coefficients) != 2 {
+			t.Errorf("parameters.%s has keys %v, want scale and bias", space, coefficients)
+		}
+		for i, key := range []string{"scale", "bias"} {
+			v, ok := coefficients[key].(float64)
+			if !ok || math.Abs(v-want[i]) > 1e-9 {
+				t.Errorf("parameters.%s.%s = %v, want %g", space, key, coefficients[key], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const lockfileExclusiveLock = 0x2
+
+// Takes an exclusive lock on the whole of f, blocking until it is available.
+func lockFile(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock, 0, 0xffffffff, 0xffffffff,
+		uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return os.NewSyscallError("LockFileEx", err)
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 0xffffffff, 0xffffffff,
+		uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return os.NewSyscallError("UnlockFileEx", err)
+	}
+	return nil
+}
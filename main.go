@@ -1,20 +1,326 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	Styles []ReportingStyle = []ReportingStyle{
-		diameterReporting{},
-		areaReporting{},
+	// The registered styles, in the order they were registered. Fitting and output iterate over
+	// this slice rather than stylesByType so that they are deterministic.
+	Styles []ReportingStyle
+	// The registered styles keyed by Type().
+	stylesByType = map[string]ReportingStyle{}
+)
+
+func init() {
+	RegisterStyle(diameterReporting{})
+	RegisterStyle(areaReporting{})
+}
+
+// Makes a reporting style available for fitting. It panics if a style of the same type has
+// already been registered.
+func RegisterStyle(style ReportingStyle) {
+	t := style.Type()
+	if _, dup := stylesByType[t]; dup {
+		panic("scali: RegisterStyle called twice for style " + t)
 	}
+	stylesByType[t] = style
+	Styles = append(Styles, style)
+}
+
+// The significance level below which a fitted scale is considered to be real rather than noise.
+const significanceLevel = 0.05
+
+var (
+	verbose = flag.Bool("verbose", false, "print additional diagnostics")
+	quiet   = flag.Bool("quiet", false,
+		"print only the calibration to stdout; warnings and errors still go to stderr")
+	strict        = flag.Bool("strict", false, "treat warnings about the measurements as errors")
+	failOnWarning = flag.Bool("fail-on-warning", false,
+		"exit with an error after the run if any warnings were printed")
+	inputPath = flag.String("input", "",
+		"read measurements from `file`, which may be gzip compressed, instead of stdin; "+
+			"defaults to $SCALI_INPUT if set")
+	strictFloat = flag.Bool("strict-float", false,
+		"warn about input numbers with more precision or range than a float64 holds, whose "+
+			"value changes when parsed")
+	maxLines = flag.Int("max-lines", 1000000,
+		"stop reading after this `many` measurements, in case a huge log is piped in by mistake; "+
+			"0 reads everything, and -follow, which doesn't keep the measurements, ignores it")
+	stdinTimeout = flag.Duration("input-stdin-timeout", 5*time.Second,
+		"fail if no input arrives on stdin within this `duration`; 0 waits forever")
+	dpiFlag = flag.Float64("dpi", 16.61,
+		"`dots` per mm of the panel, used to convert the fit to pixel units; defaults to "+
+			"$SCALI_DPI if set")
+	explainDpi = flag.Bool("explain-dpi", false,
+		"print how the emitted scale and bias are the fitted ones in mm multiplied by the dpi, "+
+			"and where the dpi came from")
+	bracketWeights = flag.Bool("bracket-weights", false,
+		"weight measurements whose physical size is a min-max bracket by the bracket width, "+
+			"narrower brackets counting for more")
+	header = flag.Bool("header", false,
+		"the first input line names the columns, which must include physical and reported and "+
+			"may include uncertainty, golden and device")
+	filter = flag.String("filter", "",
+		"read a headed input with physical and reported columns, keeping only rows matching "+
+			"`column=value`")
+	metaCols = flag.String("meta-cols", "",
+		"comma separated `list` of columns of a headed input, such as operator or rig, to carry "+
+			"through to the json format's points")
+	wide = flag.Bool("wide", false,
+		"read each line as a physical size followed by any number of reported trials at that size")
+	fixedWidth = flag.String("fixed-width", "",
+		"read fixed width input with columns given as `name=start:width,...` for the physical, "+
+			"reported and optional uncertainty columns, with 0-based starts")
+	reportedOffset = flag.Float64("reported-offset", 0,
+		"constant pedestal subtracted from each reported value before fitting; unlike the "+
+			"fitted bias this is in reported units, not mm")
+	reportedResolution = flag.Float64("reported-resolution", 0,
+		"round each reported value to the nearest multiple of `step` before fitting, to match "+
+			"the granularity the device really reports")
+	outputPath = flag.String("o", "",
+		"write the calibration as an idc fragment to `file`")
+	predict = flag.String("predict", "",
+		"print the physical size predicted for each reported value in the comma separated `list`")
+	predictFile = flag.String("predict-file", "",
+		"print the physical size predicted for each reported value in `file`, one per line")
+	predictRange = flag.String("predict-range", "",
+		"print the physical size predicted at `min,max,n[,log]`: n reported values from min to "+
+			"max, spaced linearly or, with log, geometrically")
+	ensemble = flag.Bool("ensemble", false,
+		"blend the predictions of every style, weighted by inverse error, instead of using the best")
+	dpiSweep = flag.String("dpi-sweep", "",
+		"print the emitted scale and bias for each dpi in the range `lo:hi:step` instead of "+
+			"the calibration")
+	fitReport = flag.Bool("fit-report", false,
+		"write a plain text report of the whole fit to -o, or stdout, instead of the calibration")
+	sampleCurve = flag.String("sample-curve", "",
+		"write the predicted physical size for each reported value in `lo:hi:step` as CSV instead "+
+			"of the calibration")
+	compareDpi = flag.String("compare-dpi", "",
+		"print the emitted scale and bias for each dpi in the comma separated `list` instead of "+
+			"the calibration")
+	emitMeta = flag.Bool("emit-meta", false,
+		"start the idc, -all table and -fit-report with the scali version, the time and the "+
+			"command line, for self-describing records")
+	emitEmptyOnFailure = flag.Bool("emit-empty-on-failure", false,
+		"when no calibration can be produced, still write a well-formed empty one in -format "+
+			"stating the error, before exiting non-zero: a json object with an error field, a C "+
+			"comment for cheader, or a # comment line for the other formats")
+	appendTo = flag.String("append-to", "",
+		"also add or update the -model entry of the calibration registry at `path`")
+	model       = flag.String("model", "", "device model `name` keying the entry written by -append-to")
+	diffCurrent = flag.String("diff-current", "",
+		"preview the touch.size lines of the idc at `path` that the new calibration would change")
+	diffIDC = flag.String("diff-idc", "",
+		"print a unified diff from the idc at `path` to the newly generated one instead of writing it")
+	keepAll = flag.Bool("keep-all", false,
+		"include the full result of every style that could be fit, with R² and confidence "+
+			"intervals, in json output")
+	keepAllCSV = flag.String("keep-all-csv", "",
+		"write the full result of every style that could be fit as CSV to `path`")
+	compareAllMetrics = flag.Bool("compare-all-metrics", false,
+		"report the style that wins under each of rms, mae, max error, aic and cross-validation, "+
+			"warning if they disagree, and include them in json output")
+	sanityCheck = flag.String("sanity-check", "",
+		"apply the touch.size calibration in the idc at `path` to the measurements and report "+
+			"its error beside the fit's instead of writing a calibration")
+	bestCompatible = flag.Bool("best-compatible", false,
+		"emit the best idc compatible style when the best fit cannot be written to an idc")
+	emitAllStyles = flag.String("emit-all-styles", "",
+		"write an idc for every style that could be fit into `dir` instead of the best calibration")
+	formatFlag = flag.String("format", "",
+		"output `format` for the calibration: text, idc, json, ratio, fixed, shell, cheader, "+
+			"python, plist or badge; defaults to idc with -o, otherwise text")
+	badgeThresholds = flag.String("badge-thresholds", "0.5:1",
+		"the errors in mm, `pass:review`, up to which -format badge reports PASS and REVIEW "+
+			"rather than FAIL")
+	templatePath = flag.String("template", "",
+		"write an idc overlay of only the touch.size.* keys that differ from the base idc `file`")
+	minimalIDC = flag.Bool("minimal-idc", false,
+		"write only the touch.size.* keys in the idc format, without comments")
+	maxDenominator = flag.Int64("max-denominator", 1000,
+		"largest denominator used by the ratio format")
+	fracBits = flag.Int("frac-bits", 16,
+		"number of fractional `bits` in the values written by the fixed format")
+	precision = flag.Int("precision", 6,
+		"`digits` after the decimal point in the emitted scale and bias")
+	scalePrecision = flag.Int("scale-precision", -1,
+		"`digits` after the decimal point in the emitted scale, overriding -precision")
+	biasPrecision = flag.Int("bias-precision", -1,
+		"`digits` after the decimal point in the emitted bias, overriding -precision")
+	shellProps = flag.String("shell-props", "touch.size.calibration,touch.size.scale,touch.size.bias",
+		"comma separated property `names` for the calibration, scale and bias in the shell format; "+
+			"with -scale-only the bias name may be omitted and is ignored")
+	definePrefix = flag.String("define-prefix", "TOUCH_SIZE",
+		"`prefix` of the macro names written by the cheader format")
+	exclude = flag.String("exclude", "",
+		"skip measurements whose reported value, before -reported-offset, is in `lo:hi`")
+	collapseDuplicates = flag.Bool("collapse-duplicates", false,
+		"fit measurements whose physical and reported values are exact duplicates only once")
+	checkMonotonicFlag = flag.Bool("check-monotonic", false,
+		"warn about measurements whose physical size decreases as the reported size increases")
+	sections = flag.String("sections", "",
+		"comma separated `list` of input sections to fit, numbered from 1; defaults to all")
+	sectionWeights = flag.String("section-weights", "",
+		"comma separated `list` of factors to multiply the weights of each input section by")
+	zeroReference = flag.Bool("zero-reference", false,
+		"treat the first measurement as a no-contact baseline and subtract its reported value "+
+			"from every measurement")
+	zeroReferencePhysical = flag.Bool("zero-reference-physical", false,
+		"with -zero-reference, also subtract the baseline's physical size")
+	trimRange = flag.String("trim-range", "",
+		"fit only the measurements whose reported value, after -reported-offset, is in `lo:hi`")
+	absRange = flag.String("abs-range", "",
+		"the kernel's declared ABS_MT_TOUCH_MAJOR `min:max`, as printed by evtest; warns if the "+
+			"reported values cover too little of it")
+	weightScheme = flag.String("weight-scheme", "none",
+		"automatic weighting `scheme`: none keeps the input's weights, uniform, inverse-variance "+
+			"of replicates, inverse-residual from a first fit or inverse-x of the reported value")
+	goldenWeight = flag.Float64("golden-weight", 1,
+		"`factor` to multiply the weights of measurements marked in a golden column by")
+	averageReplicatesFlag = flag.String("average-replicates", "",
+		"fit the mean reported value at each physical size, weighted by `weighting`: count, the "+
+			"number of replicates, or count/variance")
+	smooth = flag.String("smooth", "",
+		"average the measurements in `bins=N` equal width reported bins and fit the bin means")
+	anchor = flag.String("anchor", "",
+		"force the fit through a known `reported,physical` point")
+	scaleOnly = flag.Bool("scale-only", false,
+		"fit through the origin and write no touch.size.bias, for stacks that assume a zero bias")
+	theilSen = flag.Bool("theil-sen", false,
+		"fit using the outlier resistant Theil-Sen estimator instead of least squares")
+	priorScale = flag.Float64("prior-scale", 0,
+		"nominal `scale` in mm, e.g. from a similar device, that -prior-weight pulls the fit towards")
+	priorWeight = flag.Float64("prior-weight", 0,
+		"`strength` of the ridge penalty pulling the fitted scale towards -prior-scale; 0 fits "+
+			"ordinary least squares")
+	prior = flag.String("prior", "",
+		"`scale,bias,strength` of a ridge penalty pulling both the fitted scale and bias in mm "+
+			"towards a prior calibration; strength 0 fits ordinary least squares")
+	plugins = flag.String("plugin", "",
+		"comma separated `list` of Go plugins, each exporting a Style variable, whose reporting "+
+			"styles are registered alongside the built in ones")
+	listStyles = flag.Bool("list-styles", false,
+		"print the registered styles and whether they can be written to an idc, then exit")
+	limitStyles = flag.String("limit-styles", "",
+		"comma separated `list` of style types allowed to compete; defaults to all styles")
+	serveAddr = flag.String("serve", "",
+		"serve calibrations over HTTP on `addr` instead of reading input; POST measurements to /fit")
+	compareInput = flag.String("compare-input", "",
+		"fit the `old,new` measurement files independently and report how the calibration moved")
+	follow = flag.Int("follow", 0,
+		"stream measurements from the input until EOF, printing the current best fit every `n` points")
+	prefer = flag.String("prefer", "",
+		"favor the style of `type` by subtracting -prefer-bonus from its error when picking the best")
+	preferBonus = flag.Float64("prefer-bonus", 0.01,
+		"`mm` subtracted from the error of the -prefer style during selection")
+	deployable = flag.Bool("deployable", false,
+		"pick the best style by a score of -deploy-error-weight times its error plus "+
+			"-deploy-penalty if it can't be written to an idc, and print the score components")
+	deployErrorWeight = flag.Float64("deploy-error-weight", 1,
+		"`weight` of the fit error in mm in the -deployable score")
+	deployPenalty = flag.Float64("deploy-penalty", 0.1,
+		"score `penalty` added by -deployable for a style that can't be written to an idc")
+	degradeGracefully = flag.Bool("degrade-gracefully", false,
+		"instead of failing when no style can be fit, or the best can't be written to an idc, "+
+			"fall back to diameter or, failing that, the mean physical size, with a warning")
+	expectStyle = flag.String("expect-style", "",
+		"exit with an error unless the style of `type` wins")
+	scaleRange = flag.String("scale-range", "",
+		"warn, or fail with -strict, if the winning scale in mm is outside `lo:hi`")
+	biasRange = flag.String("bias-range", "",
+		"warn, or fail with -strict, if the winning bias in mm is outside `lo:hi`")
+	deviceIntercepts = flag.Bool("device-intercepts", false,
+		"fit one scale shared by every device in the input's device column and a bias for each")
+	repeat = flag.Int("repeat", 0,
+		"time `n` runs of the fit, bypassing the cache, and print the wall time statistics to stderr")
+	all        = flag.Bool("all", false, "print a table of the fit for every style")
+	noBestLine = flag.Bool("no-best-line", false,
+		"don't print the best fit and its text calibration summary, only the requested tables")
+	sortOutput = flag.String("sort-output", "error",
+		"`order` of the -all table: error (or rms), mae, r2, max, name (or type) or registered")
+	reverse     = flag.Bool("reverse", false, "reverse the -sort-output order")
+	targetScale = flag.Float64("target-scale", 0,
+		"compare the fit against a desired pixel `scale`, reporting the dpi it implies")
+	targetAccuracy = flag.Float64("target-accuracy", 0,
+		"print the reported resolution the controller must provide for the best fit to be "+
+			"accurate to `mm`")
+	worstCaseAccuracy = flag.Float64("worst-case-accuracy", 0,
+		"print the widest prediction interval over the measured range at this `confidence`, "+
+			"e.g. 0.95")
+	pixelResiduals = flag.Bool("pixel-residuals", false,
+		"print the residuals of the best fit in pixels as well as mm")
+	noHeader        = flag.Bool("no-header", false, "omit the header row of the -all table")
+	benchmarkStyles = flag.Int("benchmark-styles", 0,
+		"refit every style on `n` bootstrap resamples and report how often each one wins")
+	bootstrapEstimateFlag = flag.Int("bootstrap-estimate", 0,
+		"emit the mean scale and bias of the best style over `n` bootstrap resamples, seeded by "+
+			"-seed, instead of the values fitted to all of the measurements, and report their spread")
+	showMatrices = flag.Bool("show-matrices", false,
+		"print the normal equation matrices XᵀX and Xᵀy that least squares solves for the best style")
+	covarianceFlag = flag.Bool("covariance", false,
+		"print the covariance matrix of the fitted scale and bias, and include it in json output")
+	styleSearch = flag.Bool("style-search", false,
+		"fit a family of transforms of the reported value, such as roots, log and powers, and "+
+			"print the three with the lowest cross-validation error")
+	logLog = flag.Bool("loglog", false,
+		"fit log(physical) against log(reported) and report the power law exponent it implies")
+	learningCurve = flag.Bool("learning-curve", false,
+		"print how the best style's fit evolves as the measurements are added in input order")
+	contrast = flag.String("contrast", "",
+		"print the least squares fit of the best style beside the `robust` fit and their "+
+			"differences; the robust fit is theil-sen, also accepted as robust")
+	chunked = flag.Int("chunked", 0,
+		"fit the best style to every window of `size` consecutive measurements and print how "+
+			"the fit drifts across the input")
+	breakdown = flag.Float64("breakdown", 0,
+		"repeatedly corrupt the worst fitting measurement and refit, reporting the fraction "+
+			"corrupted when the RMS error against the original measurements first exceeds "+
+			"`mm`; expensive, and shows why -theil-sen helps")
+	parity = flag.String("parity", "",
+		"print the predicted and measured physical size of each measurement for a parity chart, "+
+			"as a table or a gnuplot script by `format`, instead of the calibration")
+	residualPlot = flag.String("residual-plot", "",
+		"plot the residual of each measurement against its reported value, as ascii art or a "+
+			"gnuplot script by `format`, instead of the calibration")
+	validateTruth = flag.String("validate", "",
+		"compare the fit's predictions with the held-out ground truth measurements in `file`")
+	predictAt = flag.String("predict-at", "",
+		"print the physical size predicted at each reported value in the comma separated `list`, "+
+			"e.g. 1,1000, for comparing devices")
+	piecewise = flag.String("piecewise", "",
+		"fit the best style with two lines meeting at the reported `breakpoint` and compare the "+
+			"combined error with the single line")
+	breakpointSearch = flag.Bool("breakpoint-search", false,
+		"search for the breakpoint that best splits the best style's fit into two lines")
+	jitterFlag = flag.Float64("jitter", 0,
+		"refit the best style with normal noise of this `stddev` added to the reported values "+
+			"and report the spread of the parameters")
+	jitterTrials = flag.Int("jitter-trials", 100, "`number` of trials run by -jitter")
+	seed         = flag.Int64("seed", 1, "seed for the random number generator used by resampling")
 )
 
 type ReportingStyle interface {
 	Apply(m Measurement) Measurement
 	Type() string
+	// A one-line description of how the reported size relates to the contact, for -list-styles.
+	Description() string
+	// Reports whether the style can be expressed as a touch.size.calibration in an idc file, or
+	// can only be used for analysis.
+	IdcCompatible() bool
 }
 
 // The reported size of the touch is relative to the diameter of the contact.
@@ -28,29 +334,91 @@ func (d diameterReporting) Type() string {
 	return "diameter"
 }
 
+func (d diameterReporting) Description() string {
+	return "reported size is proportional to the diameter of the contact"
+}
+
+func (d diameterReporting) IdcCompatible() bool {
+	return true
+}
+
 // The reported size of the touch is relative to the area of the contact.
 type areaReporting struct{}
 
 func (a areaReporting) Apply(m Measurement) Measurement {
-	return Measurement{m.Physical, math.Sqrt(m.Reported)}
+	m.Reported = math.Sqrt(m.Reported)
+	return m
 }
 
 func (a areaReporting) Type() string {
 	return "area"
 }
 
+func (a areaReporting) Description() string {
+	return "reported size is proportional to the area of the contact"
+}
+
+func (a areaReporting) IdcCompatible() bool {
+	return true
+}
+
+// Returns the registered styles named in the comma separated list of types, in list order.
+func lookupStyles(types string) ([]ReportingStyle, error) {
+	var styles []ReportingStyle
+	for _, t := range strings.Split(types, ",") {
+		t = strings.TrimSpace(t)
+		style := lookupStyle(t)
+		if style == nil {
+			return nil, fmt.Errorf("unknown style %q, expected one of %s", t, styleTypes())
+		}
+		styles = append(styles, style)
+	}
+	return styles, nil
+}
+
+func lookupStyle(t string) ReportingStyle {
+	return stylesByType[t]
+}
+
+// Returns the types of all registered styles as a comma separated list.
+func styleTypes() string {
+	types := make([]string, len(Styles))
+	for i, style := range Styles {
+		types[i] = style.Type()
+	}
+	return strings.Join(types, ", ")
+}
+
 type Measurement struct {
 	// The physical size of the touch in mm
 	Physical float64
 	// The reported size of the touch as a unit-less metric. This is the number produced by the
 	// kernel for ABS_MT_TOUCH_MAJOR.
 	Reported float64
+	// The relative weight of the measurement in the fit. Measurements read from input default to
+	// a weight of 1.
+	Weight float64
+	// The section of the input the measurement was read from, numbered from 1. Sections are
+	// separated by "---" marker lines.
+	Section int
+	// The input line the measurement was read from, or 0 if it wasn't read from input.
+	Line int
+	// Whether the measurement was marked golden, as coming from a trusted precision rig, in a
+	// golden column of the input.
+	Golden bool
+	// The device the measurement was captured on, from a device column of the input, or "".
+	Device string
+	// The values of the -meta-cols columns of the input, such as the operator or rig, carried
+	// through to the output for auditing. The fit ignores them.
+	Meta map[string]string
 }
 
 type OptimizationResult struct {
 	Type        string
 	Scale, Bias float64
 	Error       float64
+	// The standard error of Scale, or NaN if there were too few measurements to estimate it.
+	ScaleStdErr float64
 }
 
 func (o OptimizationResult) String() string {
@@ -59,45 +427,1291 @@ func (o OptimizationResult) String() string {
 }
 
 func main() {
-	// Consume input to get a list of (reported size, physical size) pairs.
-	measurements := getMeasurements()
+	log.SetFlags(0)
+	log.SetPrefix("scali: ")
+	flag.Parse()
+	applyEnvDefaults()
+	defer checkWarnings()
+	if *plugins != "" {
+		if err := loadPlugins(*plugins); err != nil {
+			log.Fatalf("-plugin: %v", err)
+		}
+	}
+
+	if *listStyles {
+		printStyles(Styles)
+		return
+	}
 	dpi := getDpi()
-	// For each reporting style, do data fitting to find the best parameters
-	scaledMeasurements := make([]Measurement, len(measurements))
-	results := make([]OptimizationResult, len(Styles))
-	for i, style := range Styles {
-		for j, m := range measurements {
-			scaledMeasurements[j] = style.Apply(m)
+	var anchorPoint *Measurement
+	if *anchor != "" {
+		reported, physical, err := parsePair(*anchor)
+		if err != nil {
+			log.Fatalf("invalid -anchor: %v", err)
+		}
+		anchorPoint = &Measurement{Physical: physical, Reported: reported, Weight: 1}
+	}
+	if *scaleOnly {
+		if anchorPoint != nil {
+			log.Fatal("-scale-only cannot be combined with -anchor")
+		}
+		// A fit through the origin has zero bias, which is what a stack that drops the bias
+		// assumes.
+		anchorPoint = &Measurement{Weight: 1}
+	}
+	styles := Styles
+	if *limitStyles != "" {
+		var err error
+		if styles, err = lookupStyles(*limitStyles); err != nil {
+			log.Fatalf("invalid -limit-styles: %v", err)
+		}
+	}
+	if *prefer != "" && lookupStyle(*prefer) == nil {
+		log.Fatalf("invalid -prefer: unknown style %q, expected one of %s", *prefer, styleTypes())
+	}
+	if *expectStyle != "" && lookupStyle(*expectStyle) == nil {
+		log.Fatalf("invalid -expect-style: unknown style %q, expected one of %s",
+			*expectStyle, styleTypes())
+	}
+	scaleBounds, biasBounds := getBounds("-scale-range", *scaleRange), getBounds("-bias-range", *biasRange)
+	if *serveAddr != "" {
+		log.Fatal(serve(*serveAddr, styles, getFitOptions(anchorPoint)))
+	}
+	if *compareInput != "" {
+		paths := strings.Split(*compareInput, ",")
+		if len(paths) != 2 {
+			log.Fatalf("invalid -compare-input: expected old,new paths, got %q", *compareInput)
+		}
+		opts := getFitOptions(anchorPoint)
+		// Each file is converted with its own #!dpi, if it has one.
+		old, oldStats := getMeasurements(paths[0])
+		cur, curStats := getMeasurements(paths[1])
+		old, cur = prepareMeasurements(old), prepareMeasurements(cur)
+		printInputComparison(old, cur, styles, opts, inputDpi(dpi, oldStats),
+			inputDpi(dpi, curStats))
+		return
+	}
+	if *follow > 0 {
+		if anchorPoint != nil {
+			log.Fatal("-anchor and -scale-only cannot be combined with -follow")
+		}
+		for _, name := range followUnsupportedFlags {
+			if isFlagSet(name) {
+				log.Fatalf("-%s cannot be combined with -follow, which doesn't keep the "+
+					"measurements to prepare them", name)
+			}
 		}
-		scale, bias := findScaleAndBias(scaledMeasurements)
-		stdError := calculateError(scaledMeasurements, scale, bias)
-		results[i] = OptimizationResult{style.Type(), scale, bias, stdError}
+		if getFitOptions(nil) != (fitOptions{}) {
+			log.Fatal("-follow only fits ordinary least squares; -theil-sen, -prior and " +
+				"-prior-weight cannot be combined with it")
+		}
+		in := openInput(*inputPath)
+		defer in.Close()
+		if err := followFit(in, getParseOptions(), styles, *follow, dpi); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Consume input to get a list of (reported size, physical size) pairs.
+	measurements, stats := getMeasurements(*inputPath)
+	dpi = inputDpi(dpi, stats)
+	measurements = prepareMeasurements(measurements)
+	opts := getFitOptions(anchorPoint)
+	if *benchmarkStyles > 0 {
+		rng := rand.New(rand.NewSource(*seed))
+		wins := benchmarkStyleWins(measurements, styles, opts, *benchmarkStyles, rng)
+		printStyleWins(styles, wins, *benchmarkStyles)
+		return
+	}
+	if *styleSearch {
+		printStyleSearch(measurements, opts)
+		return
 	}
+	if *logLog {
+		a, b, logError, err := findPowerLaw(measurements)
+		if err != nil {
+			log.Fatalf("-loglog: %v", err)
+		}
+		printPowerLaw(a, b, logError)
+		return
+	}
+	if *deviceIntercepts {
+		var best deviceFit
+		for _, style := range styles {
+			fit, err := fitDeviceIntercepts(measurements, style)
+			if err != nil {
+				warnf("-device-intercepts: skipping %s: %v", style.Type(), err)
+				continue
+			}
+			if best.Type == "" || fit.Error < best.Error || math.IsNaN(best.Error) {
+				best = fit
+			}
+		}
+		if best.Type == "" {
+			failf("-device-intercepts: none of the styles could be fit")
+		}
+		printDeviceFit(best, dpi)
+		return
+	}
+	if *repeat > 0 {
+		timeFits(measurements, styles, opts, *repeat)
+	}
+	// For each reporting style, do data fitting to find the best parameters
+	results := fitStyles(measurements, styles, opts)
 	// Using the optimal parameters, calculate the error for each type of size data
-	bestResult := results[0]
-	for _, r := range results {
-		if r.Error < bestResult.Error {
-			bestResult = r
+	bestResult := findBestResult(results)
+	if *prefer != "" {
+		preferred := findPreferredResult(results, *prefer, *preferBonus)
+		if preferred.Type != bestResult.Type {
+			infof("Preferring %s with error %f over %s with error %f", preferred.Type,
+				preferred.Error, bestResult.Type, bestResult.Error)
+			bestResult = preferred
+		}
+	}
+	if *deployable {
+		if *deployErrorWeight <= 0 {
+			log.Fatalf("invalid -deploy-error-weight: must be positive, got %g", *deployErrorWeight)
+		}
+		deployed, scores := findDeployableResult(results, *deployErrorWeight, *deployPenalty)
+		if !*quiet {
+			printDeployScores(scores)
+		}
+		if deployed.Type != bestResult.Type {
+			infof("Deploying %s with error %f over %s with error %f", deployed.Type,
+				deployed.Error, bestResult.Type, bestResult.Error)
+			bestResult = deployed
+		}
+	}
+	if math.IsNaN(bestResult.Error) && *degradeGracefully {
+		fallback, how := degradeResult(measurements, opts)
+		warnf("no style could be fit to the measurements; falling back to %s", how)
+		bestResult = fallback
+	}
+	if math.IsNaN(bestResult.Error) {
+		// Nothing could be fit, so refit to find out why.
+		_, err := Fit(measurements, lookupStyle(bestResult.Type), opts)
+		if err == nil {
+			err = fmt.Errorf("no style could be fit to the measurements")
+		}
+		failf("%v", err)
+	}
+	// Checked before any of the modes below, since most of them return early.
+	if *expectStyle != "" && bestResult.Type != *expectStyle {
+		log.Fatalf("expected the %s style to win, but %s did", *expectStyle, bestResult.Type)
+	}
+	if *all {
+		sorted, err := sortResults(results, measurements, *sortOutput, *reverse)
+		if err != nil {
+			log.Fatalf("invalid -sort-output: %v", err)
+		}
+		printResultsTable(sorted, !*noHeader)
+	}
+	if *showMatrices {
+		printNormalEquations(lookupStyle(bestResult.Type), measurements)
+	}
+	if !*noBestLine {
+		infof("%v", bestResult)
+	}
+	checkBounds("scale", bestResult.Scale, scaleBounds)
+	checkBounds("bias", bestResult.Bias, biasBounds)
+	if len(measurements) <= 2 {
+		warnf("at least 3 measurements are needed to test whether the fit is significant")
+	} else if !leastSquaresFit(opts) {
+		infof("Not testing whether the fitted scale is significant, since the test assumes a " +
+			"least squares fit")
+	} else if !IsSignificant(bestResult, len(measurements), significanceLevel) {
+		warnf("fitted scale is not significantly different from zero (p=%.3g); "+
+			"there may be too few or too noisy measurements", slopePValue(bestResult, len(measurements)))
+	}
+	if *jitterFlag > 0 {
+		rng := rand.New(rand.NewSource(*seed))
+		printJitterSensitivity(measurements, lookupStyle(bestResult.Type), opts, *jitterFlag,
+			*jitterTrials, rng)
+	}
+	if *learningCurve {
+		if isWeighted(measurements) || opts.InverseResidual {
+			log.Fatal("-learning-curve does not support weighted measurements")
+		}
+		printLearningCurve(measurements, lookupStyle(bestResult.Type))
+	}
+	if *contrast != "" {
+		if *contrast != "theil-sen" && *contrast != "robust" {
+			log.Fatalf("invalid -contrast %q: the only robust fit is theil-sen", *contrast)
 		}
+		printContrast(measurements, lookupStyle(bestResult.Type))
+	}
+	if *chunked > 0 {
+		printChunks(measurements, lookupStyle(bestResult.Type), opts, *chunked)
+	}
+	if *breakdown > 0 {
+		printBreakdown(measurements, lookupStyle(bestResult.Type), opts, *breakdown)
+	}
+	if *parity != "" {
+		err := printParity(lookupStyle(bestResult.Type), bestResult, measurements, *parity)
+		if err != nil {
+			log.Fatalf("invalid -parity: %v", err)
+		}
+		return
+	}
+	if *residualPlot != "" {
+		err := printResidualPlot(lookupStyle(bestResult.Type), bestResult, measurements,
+			*residualPlot)
+		if err != nil {
+			log.Fatalf("invalid -residual-plot: %v", err)
+		}
+		return
+	}
+	if *validateTruth != "" {
+		truth, _ := getMeasurements(*validateTruth)
+		printValidation(lookupStyle(bestResult.Type), bestResult, truth)
+	}
+	if *predictAt != "" {
+		reported, err := parseFloats(*predictAt)
+		if err != nil {
+			log.Fatalf("invalid -predict-at: %v", err)
+		}
+		printReferencePredictions(lookupStyle(bestResult.Type), bestResult, reported)
+	}
+	if *piecewise != "" {
+		breakpoint, err := parseNumber(*piecewise)
+		if err != nil {
+			log.Fatalf("invalid -piecewise: %v", err)
+		}
+		style := lookupStyle(bestResult.Type)
+		fit, err := fitSegments(measurements, style, breakpoint)
+		if err != nil {
+			log.Fatalf("-piecewise: %v", err)
+		}
+		printSegments(fit, style, bestResult)
+	}
+	if *breakpointSearch {
+		printBreakpointSearch(measurements, lookupStyle(bestResult.Type), bestResult, opts)
+	}
+	if *targetScale != 0 {
+		printTargetScale(measurements, lookupStyle(bestResult.Type), bestResult, dpi, *targetScale)
+	}
+	if *targetAccuracy != 0 {
+		if *targetAccuracy < 0 {
+			log.Fatalf("invalid -target-accuracy: must be positive, got %g", *targetAccuracy)
+		}
+		printRequiredResolution(lookupStyle(bestResult.Type), bestResult, measurements,
+			*targetAccuracy)
+	}
+	if *worstCaseAccuracy != 0 {
+		if *worstCaseAccuracy <= 0 || *worstCaseAccuracy >= 1 {
+			log.Fatalf("invalid -worst-case-accuracy: confidence must be between 0 and 1, got %g",
+				*worstCaseAccuracy)
+		}
+		if len(measurements) <= 2 {
+			log.Fatal("-worst-case-accuracy needs at least 3 measurements")
+		}
+		printWorstCaseAccuracy(lookupStyle(bestResult.Type), bestResult, measurements,
+			*worstCaseAccuracy)
+	}
+	if *pixelResiduals {
+		if dpi <= 0 {
+			log.Fatalf("-pixel-residuals needs a positive -dpi, got %g", dpi)
+		}
+		printPixelResiduals(lookupStyle(bestResult.Type), bestResult, measurements, dpi)
+	}
+	if *verbose {
+		stats := computeStats(lookupStyle(bestResult.Type), bestResult, measurements)
+		infof("RMS=%f, MAE=%f, max error=%f, R²=%f", stats.RMS, stats.MAE, stats.MaxError, stats.R2)
+		if integerReported(measurements) {
+			style := lookupStyle(bestResult.Type)
+			r := reportedRange(measurements)
+			lo := Predict(style, bestResult, r.Lo+1) - Predict(style, bestResult, r.Lo)
+			hi := Predict(style, bestResult, r.Hi) - Predict(style, bestResult, r.Hi-1)
+			infof("Every reported value is an integer, so the device likely quantizes sizes: one "+
+				"reported unit is %f mm at reported=%g and %f mm at reported=%g, and the fit "+
+				"can't be more precise than that on the device", lo, r.Lo, hi, r.Hi)
+		}
+		if stats.N > 2 && leastSquaresFit(opts) {
+			infof("Scale t=%f with %d degrees of freedom, p=%.3g",
+				stats.Scale/bestResult.ScaleStdErr, stats.N-2, slopePValue(bestResult, stats.N))
+		}
+	}
+	if *covarianceFlag {
+		printCovariance(covariance(lookupStyle(bestResult.Type), bestResult, measurements))
+	}
+	if *scaleOnly {
+		checkScaleOnly(lookupStyle(bestResult.Type), bestResult, measurements)
+	} else if anchorPoint != nil {
+		infof("Anchored at reported=%f, physical=%f", anchorPoint.Reported, anchorPoint.Physical)
+	}
+	if opts.PriorWeight > 0 {
+		ols := fits.Fit(measurements, lookupStyle(bestResult.Type), fitOptions{})
+		infof("Prior moved the scale from %f to %f (%+f) and the bias from %f to %f (%+f)",
+			ols.Scale, bestResult.Scale, bestResult.Scale-ols.Scale, ols.Bias, bestResult.Bias,
+			bestResult.Bias-ols.Bias)
+		if opts.PenalizeBias {
+			infof("The fit is %+f from the prior scale %f and %+f from the prior bias %f",
+				bestResult.Scale-opts.PriorScale, opts.PriorScale, bestResult.Bias-opts.PriorBias,
+				opts.PriorBias)
+		}
+	}
+	if *theilSen {
+		style := lookupStyle(bestResult.Type)
+		ols := fits.Fit(measurements, style, fitOptions{})
+		infof("Theil-Sen error=%f, OLS error=%f (OLS Scale=%f, Bias=%f)",
+			bestResult.Error, ols.Error, ols.Scale, ols.Bias)
+	}
+	if *fitReport {
+		if err := emitFitReport(*outputPath, measurements, results, bestResult, opts, dpi); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *predict != "" || *predictFile != "" || *predictRange != "" {
+		var reported []float64
+		if *predict != "" {
+			vals, err := parseFloats(*predict)
+			if err != nil {
+				log.Fatalf("invalid -predict: %v", err)
+			}
+			reported = append(reported, vals...)
+		}
+		if *predictFile != "" {
+			f, err := os.Open(*predictFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			vals, err := readValues(f)
+			f.Close()
+			if err != nil {
+				log.Fatalf("%s: %v", *predictFile, err)
+			}
+			reported = append(reported, vals...)
+		}
+		if *predictRange != "" {
+			vals, err := parsePredictRange(*predictRange)
+			if err != nil {
+				log.Fatalf("invalid -predict-range: %v", err)
+			}
+			reported = append(reported, vals...)
+		}
+		if *ensemble {
+			if err := printEnsemblePredictions(styles, results, measurements, reported); err != nil {
+				failf("-ensemble: %v", err)
+			}
+		} else {
+			printPredictions(lookupStyle(bestResult.Type), bestResult, measurements, reported)
+		}
+		return
+	}
+	if *dpiSweep != "" {
+		// The fit is in mm and doesn't depend on the dpi, so only the conversion is swept.
+		lo, hi, step, err := parseSweep(*dpiSweep)
+		if err != nil {
+			log.Fatalf("invalid -dpi-sweep: %v", err)
+		}
+		printDpiTable(bestResult, sweepDpis(lo, hi, step))
+		return
+	}
+	if *sampleCurve != "" {
+		lo, hi, step, err := parseSweep(*sampleCurve)
+		if err != nil {
+			log.Fatalf("invalid -sample-curve: %v", err)
+		}
+		if err := writeCurve(os.Stdout, lookupStyle(bestResult.Type), bestResult, lo, hi,
+			step); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *compareDpi != "" {
+		dpis, err := parseFloats(*compareDpi)
+		if err != nil {
+			log.Fatalf("invalid -compare-dpi: %v", err)
+		}
+		printDpiTable(bestResult, dpis)
+		return
+	}
+	if *emitAllStyles != "" {
+		if err := writeAllIDCs(*emitAllStyles, results, dpi, measurements); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *bestCompatible && !lookupStyle(bestResult.Type).IdcCompatible() {
+		compatible, ok := findBestCompatibleResult(results)
+		if !ok {
+			failf("-best-compatible: none of the styles can be written to an idc")
+		}
+		warnf("the best fit, %s with error %f, cannot be written to an idc; "+
+			"using %s with error %f instead, %f mm worse", bestResult.Type, bestResult.Error,
+			compatible.Type, compatible.Error, compatible.Error-bestResult.Error)
+		bestResult = compatible
+	}
+	if *bootstrapEstimateFlag > 0 {
+		// This changes the emitted numbers: every output below uses the bootstrap means.
+		rng := rand.New(rand.NewSource(*seed))
+		estimate, scaleSD, biasSD, ok := bootstrapEstimate(measurements,
+			lookupStyle(bestResult.Type), opts, bestResult, *bootstrapEstimateFlag, rng)
+		if !ok {
+			failf("-bootstrap-estimate: none of the %d resamples could be fit", *bootstrapEstimateFlag)
+		}
+		infof("Bootstrap estimate of %s over %d resamples: scale=%f (stddev %f, %+f from the fit), "+
+			"bias=%f (stddev %f, %+f from the fit), error=%f", bestResult.Type,
+			*bootstrapEstimateFlag, estimate.Scale, scaleSD, estimate.Scale-bestResult.Scale,
+			estimate.Bias, biasSD, estimate.Bias-bestResult.Bias, estimate.Error)
+		bestResult = estimate
 	}
-	fmt.Println(bestResult)
 	// Produce an idc file with the appropriate parameters
-	fmt.Printf("Bias=%f, Scale=%f\n", dpi*bestResult.Bias, dpi*bestResult.Scale)
+	c := calibration{bestResult, dpi, measurements, results, opts}
+	if *compareAllMetrics {
+		winners := selectionWinners(results, measurements, opts)
+		for _, rule := range selectionRules {
+			if t, ok := winners[rule]; ok {
+				infof("Winner by %s: %s", rule, t)
+			}
+		}
+		if !unanimous(winners) {
+			warnf("the selection rules disagree on the best style; review the choice of %s",
+				bestResult.Type)
+		}
+	}
+	if *keepAllCSV != "" {
+		if err := writeKeptResultsCSV(*keepAllCSV, keptResults(results, measurements,
+			bestResult.Type)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *sanityCheck != "" {
+		if err := printSanityCheck(*sanityCheck, measurements, bestResult, dpi); err != nil {
+			log.Fatalf("-sanity-check: %v", err)
+		}
+		return
+	}
+	if *diffCurrent != "" {
+		if err := printIDCChanges(*diffCurrent, c); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *diffIDC != "" {
+		if !lookupStyle(bestResult.Type).IdcCompatible() {
+			log.Fatalf("-diff-idc: the %s style cannot be written to an idc", bestResult.Type)
+		}
+		if err := printIDCDiff(*diffIDC, c); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *explainDpi {
+		printDpiExplanation(c, dpiSource(stats))
+	}
+	format := outputFormat()
+	// The summary line still goes to stdout when the calibration itself goes to a file.
+	if *outputPath != "" && !*quiet && !*noBestLine {
+		writeText(os.Stdout, c)
+	}
+	if *appendTo != "" {
+		if err := updateRegistry(*appendTo, *model, c); err != nil {
+			log.Fatalf("-append-to: %v", err)
+		}
+	}
+	if idcFormats[format] && !lookupStyle(bestResult.Type).IdcCompatible() && *degradeGracefully {
+		fallback, ok := findBestCompatibleResult(results)
+		how := fmt.Sprintf("%s with error %f", fallback.Type, fallback.Error)
+		if !ok {
+			fallback, how = degradeResult(measurements, opts)
+		}
+		warnf("the %s style cannot be written to an idc; falling back to %s", bestResult.Type, how)
+		bestResult = fallback
+		c = calibration{bestResult, dpi, measurements, results, opts}
+	}
+	if idcFormats[format] && !lookupStyle(bestResult.Type).IdcCompatible() {
+		msg := fmt.Sprintf("the %s style cannot be written to an idc", bestResult.Type)
+		if compatible, ok := findBestCompatibleResult(results); ok {
+			msg += fmt.Sprintf("; the best idc compatible style is %s with error %f",
+				compatible.Type, compatible.Error)
+		}
+		failf("%s", msg)
+	}
+	// Written to stdout, the text format is nothing but the summary line.
+	if !*noBestLine || format != "text" || *outputPath != "" {
+		if err := emitCalibration(*outputPath, format, c); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Validates, filters and reweights the measurements as requested by the flags.
+func prepareMeasurements(ms []Measurement) []Measurement {
+	if *reportedResolution != 0 {
+		if *reportedResolution < 0 {
+			log.Fatalf("invalid -reported-resolution: must be positive, got %g", *reportedResolution)
+		}
+		var changed int
+		var maxShift float64
+		ms, changed, maxShift = quantizeReported(ms, *reportedResolution, *reportedOffset)
+		infof("Rounded %d of %d reported values to multiples of %g, moving them by up to %g",
+			changed, len(ms), *reportedResolution, maxShift)
+	}
+	if *zeroReference {
+		ms = subtractZeroReference(ms, *zeroReferencePhysical)
+	}
+	if unique, n := dropDuplicates(ms); n > 0 {
+		if *collapseDuplicates {
+			infof("Collapsed %d exact duplicate measurements", n)
+			ms = unique
+		} else if *averageReplicatesFlag == "" {
+			// Averaging replicates expects repeated measurements.
+			warnOrFail("%d measurements exactly duplicate an earlier one's physical and reported "+
+				"values; use -collapse-duplicates to fit each once", n)
+		}
+	}
+	if *checkMonotonicFlag {
+		for _, problem := range checkMonotonic(ms) {
+			warnOrFail("%s", problem)
+		}
+	}
+	if *weightScheme != "none" {
+		scheme, ok := weightSchemes[*weightScheme]
+		if !ok {
+			log.Fatalf("invalid -weight-scheme %q: must be one of %s", *weightScheme,
+				weightSchemeNames())
+		}
+		if *weightScheme == "inverse-residual" {
+			// The residuals depend on the style, so the weights are computed as each is fit.
+			infof("Weighting each style's fit by its own residuals")
+		} else {
+			if err := scheme(ms); err != nil {
+				log.Fatalf("-weight-scheme %s: %v", *weightScheme, err)
+			}
+			infof("Weighted the measurements with the %s scheme", *weightScheme)
+		}
+	}
+	if *goldenWeight != 1 {
+		if *goldenWeight <= 0 {
+			log.Fatalf("invalid -golden-weight: must be positive, got %g", *goldenWeight)
+		}
+		boosted := 0
+		for i := range ms {
+			if ms[i].Golden {
+				ms[i].Weight *= *goldenWeight
+				boosted++
+			}
+		}
+		infof("Boosted the weight of %d golden measurements by %g", boosted, *goldenWeight)
+	}
+	if *sectionWeights != "" {
+		weights, err := parseFloats(*sectionWeights)
+		if err != nil {
+			log.Fatalf("invalid -section-weights: %v", err)
+		}
+		weightSections(ms, weights)
+	}
+	if r := getBounds("-trim-range", *trimRange); r != nil {
+		var inside []Measurement
+		for _, m := range ms {
+			if r.Contains(m.Reported) {
+				inside = append(inside, m)
+			}
+		}
+		if len(inside) == 0 {
+			log.Fatalf("no measurements have reported values in -trim-range %s", *trimRange)
+		}
+		infof("%d of %d measurements are inside -trim-range; the calibration is only valid there",
+			len(inside), len(ms))
+		ms = inside
+	}
+	if *sections != "" {
+		keep, err := parseFloats(*sections)
+		if err != nil {
+			log.Fatalf("invalid -sections: %v", err)
+		}
+		if ms = filterSections(ms, keep); len(ms) == 0 {
+			log.Fatalf("no measurements in sections %s", *sections)
+		}
+	}
+	if *averageReplicatesFlag != "" {
+		if *smooth != "" {
+			log.Fatal("-average-replicates cannot be combined with -smooth")
+		}
+		groups, err := averageReplicates(ms, *averageReplicatesFlag)
+		if err != nil {
+			log.Fatalf("invalid -average-replicates: %v", err)
+		}
+		ms = make([]Measurement, len(groups))
+		for i, g := range groups {
+			ms[i] = g.Mean
+		}
+		if !*quiet {
+			printReplicateGroups(groups)
+		}
+	}
+	if *smooth != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(*smooth, "bins="))
+		if err != nil || n <= 0 || !strings.HasPrefix(*smooth, "bins=") {
+			log.Fatalf("invalid -smooth: expected bins=N with N > 0, got %q", *smooth)
+		}
+		ms = binMeasurements(ms, n)
+		infof("Smoothed into %d non-empty bins", len(ms))
+	}
+	if problem := checkPhysicalRange(ms); problem != "" {
+		warnOrFail("%s", problem)
+	}
+	if r := getBounds("-abs-range", *absRange); r != nil {
+		if r.Hi <= r.Lo {
+			log.Fatalf("invalid -abs-range: the range %s is empty", *absRange)
+		}
+		coverage, problem := checkAbsRange(ms, *r)
+		infof("Reported values cover %.1f%% of the kernel's declared range", 100*coverage)
+		if problem != "" {
+			warnOrFail("%s", problem)
+		}
+	}
+	if *verbose && isWeighted(ms) {
+		printWeights(ms)
+	}
+	return ms
+}
+
+// Returns a copy of ms with each reported value rounded to the nearest multiple of step, along with
+// the number of values that changed and the largest change. The rounding is of the raw values the
+// device reports, before offset was subtracted from them.
+func quantizeReported(ms []Measurement, step, offset float64) ([]Measurement, int, float64) {
+	rounded := make([]Measurement, len(ms))
+	changed := 0
+	maxShift := 0.0
+	for i, m := range ms {
+		q := math.Round((m.Reported+offset)/step)*step - offset
+		if shift := math.Abs(q - m.Reported); shift > 0 {
+			changed++
+			maxShift = math.Max(maxShift, shift)
+		}
+		m.Reported = q
+		rounded[i] = m
+	}
+	return rounded, changed, maxShift
+}
+
+// Returns a copy of ms with the reported value of the first measurement, a no-contact baseline,
+// subtracted from every reported value, and with physical also its physical size from every
+// physical size.
+func subtractZeroReference(ms []Measurement, physical bool) []Measurement {
+	ref := ms[0]
+	if !physical {
+		ref.Physical = 0
+	}
+	shifted := make([]Measurement, len(ms))
+	negative := 0
+	for i, m := range ms {
+		m.Reported -= ref.Reported
+		m.Physical -= ref.Physical
+		if m.Reported < 0 {
+			negative++
+		}
+		shifted[i] = m
+	}
+	infof("Zero reference on %s: subtracted %g from the reported and %g from the physical sizes",
+		describeRow(ref), ref.Reported, ref.Physical)
+	if negative > 0 {
+		warnOrFail("the zero reference makes %d reported values negative; the area style cannot "+
+			"take their square root", negative)
+	}
+	return shifted
+}
+
+// Prints an informational line to stdout, unless -quiet is set. When a structured format is
+// written to stdout the line goes to stderr instead, so that stdout still parses.
+func infof(format string, args ...interface{}) {
+	if *quiet {
+		return
+	}
+	if *outputPath == "" && structuredFormats[outputFormat()] {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+		return
+	}
+	fmt.Printf(format+"\n", args...)
+}
+
+// The number of warnings logged by warnf.
+var warnings int
+
+// Logs a warning and counts it, so that -fail-on-warning can fail the run once every warning
+// has been printed.
+func warnf(format string, args ...interface{}) {
+	warnings++
+	log.Printf("warning: "+format, args...)
+}
+
+// Exits with an error if -fail-on-warning is set and any warnings were logged.
+func checkWarnings() {
+	if *failOnWarning && warnings > 0 {
+		log.Fatalf("failing because of %d warnings and -fail-on-warning", warnings)
+	}
+}
+
+// Reports a problem with the data as a warning, or as a fatal error under -strict.
+func warnOrFail(format string, args ...interface{}) {
+	if *strict {
+		failf(format, args...)
+	}
+	warnf(format, args...)
+}
+
+// Returns the -format to write the calibration in, which defaults to idc when it goes to a file
+// with -o and to text otherwise.
+func outputFormat() string {
+	switch {
+	case *formatFlag != "":
+		return *formatFlag
+	case *outputPath != "":
+		return "idc"
+	}
+	return "text"
+}
+
+// Exits as log.Fatalf does because no calibration could be produced. With
+// -emit-empty-on-failure, an empty calibration stating the failure is first written where the
+// calibration would have gone, so that a pipeline can tell a failed fit from a crash.
+func failf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if *emitEmptyOnFailure {
+		if err := emitFailure(*outputPath, outputFormat(), msg); err != nil {
+			log.Printf("-emit-empty-on-failure: %v", err)
+		}
+	}
+	log.Fatal(msg)
+}
+
+// Parses the value of the range flag name, returning nil if it isn't set.
+func getBounds(name, value string) *valueRange {
+	if value == "" {
+		return nil
+	}
+	r, err := parseRange(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	return &r
+}
+
+// Reports the fitted parameter name through warnOrFail if bounds is set and doesn't contain v.
+func checkBounds(name string, v float64, bounds *valueRange) {
+	if bounds == nil || bounds.Contains(v) {
+		return
+	}
+	if v < bounds.Lo {
+		warnOrFail("fitted %s %f is below the lower bound %g of its plausible range", name, v, bounds.Lo)
+	} else {
+		warnOrFail("fitted %s %f is above the upper bound %g of its plausible range", name, v, bounds.Hi)
+	}
+}
+
+// Opens the file at path, or returns stdin if path is empty. Exits if nothing arrives on stdin
+// within -input-stdin-timeout, so that a run that was accidentally given no input doesn't hang.
+func openInput(path string) io.ReadCloser {
+	if path == "" {
+		return waitForStdin(*stdinTimeout)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(2)
+	if !bytes.Equal(magic, gzipMagic) && !strings.HasSuffix(path, ".gz") {
+		return readCloser{r, f}
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		log.Fatalf("%s: not a valid gzip file: %v", path, err)
+	}
+	return readCloser{zr, f}
+}
+
+// The first two bytes of every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Reads from a Reader layered over a file, such as a decompressor, and closes the file.
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
 
-func getMeasurements() []Measurement {
-	return []Measurement{
-		Measurement{4.85, 6},
-		Measurement{6.9, 8},
-		Measurement{8.85, 11},
-		Measurement{11, 14},
-		Measurement{13.91, 18},
-		Measurement{21.91, 28},
+// Returns stdin once it has data, or has reached EOF, exiting if neither happens within timeout.
+func waitForStdin(timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 {
+		return os.Stdin
 	}
+	type chunk struct {
+		data []byte
+		err  error
+	}
+	first := make(chan chunk, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		n, err := os.Stdin.Read(buf)
+		first <- chunk{buf[:n], err}
+	}()
+	select {
+	case c := <-first:
+		r := io.MultiReader(bytes.NewReader(c.data), os.Stdin)
+		if c.err != nil {
+			r = io.MultiReader(bytes.NewReader(c.data), errReader{c.err})
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{r, os.Stdin}
+	case <-time.After(timeout):
+		log.Fatalf("no input received within %v", timeout)
+	}
+	return nil
+}
+
+// A reader that always fails with its error, to replay the error of a read that already happened.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// Returns the fit options selected by the flags, exiting if they conflict.
+func getFitOptions(anchor *Measurement) fitOptions {
+	if anchor != nil && *theilSen {
+		log.Fatal("-anchor cannot be combined with -theil-sen")
+	}
+	if *priorWeight < 0 {
+		log.Fatalf("invalid -prior-weight: must not be negative, got %g", *priorWeight)
+	}
+	if *priorWeight > 0 && (anchor != nil || *theilSen) {
+		log.Fatal("-prior-weight cannot be combined with -anchor or -theil-sen")
+	}
+	if *prior != "" {
+		vals, err := parseFloatList(*prior, ",", 3)
+		if err != nil {
+			log.Fatalf("invalid -prior: %v", err)
+		}
+		if vals[2] < 0 {
+			log.Fatalf("invalid -prior: strength must not be negative, got %g", vals[2])
+		}
+		if *priorWeight > 0 {
+			log.Fatal("-prior cannot be combined with -prior-weight")
+		}
+		if anchor != nil || *theilSen {
+			log.Fatal("-prior cannot be combined with -anchor or -theil-sen")
+		}
+		return fitOptions{PriorScale: vals[0], PriorBias: vals[1], PriorWeight: vals[2],
+			PenalizeBias: true, InverseResidual: *weightScheme == "inverse-residual"}
+	}
+	return fitOptions{Anchor: anchor, TheilSen: *theilSen, PriorScale: *priorScale,
+		PriorWeight: *priorWeight, InverseResidual: *weightScheme == "inverse-residual"}
+}
+
+func getParseOptions() parseOptions {
+	opts := parseOptions{ReportedOffset: *reportedOffset}
+	if *fixedWidth != "" {
+		spec, err := parseFixedWidthSpec(*fixedWidth)
+		if err != nil {
+			log.Fatalf("invalid -fixed-width: %v", err)
+		}
+		opts.FixedWidth = spec
+	}
+	opts.BracketWeights = *bracketWeights
+	opts.StrictFloat = *strictFloat
+	opts.Wide = *wide
+	if opts.Wide && (*header || *filter != "" || *metaCols != "" || opts.FixedWidth != nil) {
+		log.Fatal("-wide cannot be combined with -header, -filter, -meta-cols or -fixed-width")
+	}
+	opts.MaxMeasurements = *maxLines
+	opts.Header = *header || *filter != "" || *metaCols != ""
+	if *metaCols != "" {
+		opts.MetaColumns = strings.Split(*metaCols, ",")
+	}
+	if opts.Header && opts.FixedWidth != nil {
+		log.Fatal("-header, -filter and -meta-cols cannot be combined with -fixed-width")
+	}
+	if *filter != "" {
+		f, err := parseColumnFilter(*filter)
+		if err != nil {
+			log.Fatalf("invalid -filter: %v", err)
+		}
+		opts.Filter = f
+	}
+	if *exclude != "" {
+		r, err := parseRange(*exclude)
+		if err != nil {
+			log.Fatalf("invalid -exclude: %v", err)
+		}
+		opts.ExcludeReported = &r
+	}
+	return opts
+}
+
+// Reads the measurements in the file at path, or stdin if path is empty, exiting on failure.
+func getMeasurements(path string) ([]Measurement, inputStats) {
+	in := openInput(path)
+	defer in.Close()
+	ms, stats, err := readMeasurements(in, getParseOptions())
+	if err != nil {
+		if path != "" {
+			log.Fatalf("%s: %v", path, err)
+		}
+		log.Fatal(err)
+	}
+	if stats.Excluded > 0 && !*quiet {
+		log.Printf("excluded %d measurements", stats.Excluded)
+	}
+	if stats.Truncated {
+		warnf("input truncated after %d measurements; raise -max-lines to read more",
+			len(ms))
+	}
+	if stats.Filtered > 0 && !*quiet {
+		log.Printf("filtered out %d rows", stats.Filtered)
+	}
+	for _, name := range stats.UnknownDirectives {
+		warnf("ignoring unknown directive #!%s", name)
+	}
+	for _, lossy := range stats.LossyFloats {
+		warnf("%s, losing precision", lossy)
+	}
+	if len(ms) == 0 {
+		failf("no measurements found in input")
+	}
+	warnNegativeReported(stats.NegativeReported)
+	return ms, stats
+}
+
+// Warns that -reported-offset made negative reported values negative, wherever the measurements
+// came from.
+func warnNegativeReported(negative int) {
+	if negative > 0 {
+		warnf("-reported-offset %g makes %d reported values negative; "+
+			"the area style cannot take their square root", *reportedOffset, negative)
+	}
+}
+
+// The environment variables that supply a default for a flag that isn't given, keyed by flag
+// name. A flag on the command line takes precedence over its variable, which takes precedence
+// over the built in default.
+var envDefaults = map[string]string{
+	"dpi":   "SCALI_DPI",
+	"input": "SCALI_INPUT",
+}
+
+// Sets each flag in envDefaults that wasn't given on the command line from its environment
+// variable, if that is set, exiting if the value is invalid for the flag.
+func applyEnvDefaults() {
+	for name, env := range envDefaults {
+		value, ok := os.LookupEnv(env)
+		if !ok || isFlagSet(name) {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			log.Fatalf("invalid value %q for $%s: %v", value, env, err)
+		}
+		setFromEnv[name] = true
+	}
+}
+
+// The flags that applyEnvDefaults set from the environment.
+var setFromEnv = make(map[string]bool)
+
+// Describes where the dpi the calibration is converted with came from, given the stats of the
+// input it was read from.
+func dpiSource(stats inputStats) string {
+	switch {
+	case setFromEnv["dpi"]:
+		return "$" + envDefaults["dpi"]
+	case isFlagSet("dpi"):
+		return "-dpi"
+	case stats.Dpi != 0:
+		return "the input's #!dpi directive"
+	}
+	return "the built in default of -dpi"
+}
+
+// Returns the dpi to convert the calibration of an input with the given stats with: its #!dpi
+// directive, unless -dpi was given, or else dpi.
+func inputDpi(dpi float64, stats inputStats) float64 {
+	if stats.Dpi != 0 && !isFlagSet("dpi") {
+		return stats.Dpi
+	}
+	return dpi
+}
+
+// Reports whether the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 func getDpi() float64 {
-	return 16.61
+	return *dpiFlag
+}
+
+type fitOptions struct {
+	// If non-nil, the fitted line is constrained to pass through this (untransformed) point.
+	Anchor *Measurement
+	// Use the Theil-Sen estimator instead of ordinary least squares.
+	TheilSen bool
+	// If PriorWeight is positive, add the ridge penalty PriorWeight * (scale - PriorScale)^2 to
+	// the least squares objective, pulling the fitted scale towards PriorScale.
+	PriorScale, PriorWeight float64
+	// If PenalizeBias, the penalty also includes PriorWeight * (bias - PriorBias)^2.
+	PriorBias    float64
+	PenalizeBias bool
+	// Weight each measurement by weightInverseResidual, computed from the style's own
+	// transformed values so that every style is weighted by its own residuals.
+	InverseResidual bool
+}
+
+// Fits each style to ms, returning the results in the same order as styles.
+func fitStyles(ms []Measurement, styles []ReportingStyle, opts fitOptions) []OptimizationResult {
+	results := make([]OptimizationResult, len(styles))
+	for i, style := range styles {
+		results[i] = fits.Fit(ms, style, opts)
+	}
+	return results
+}
+
+// Fits every style to ms n times, without the cache, and logs the mean and standard deviation of
+// the wall time each run took. Exits if the runs don't all produce the same results, since the
+// fit is meant to be deterministic.
+func timeFits(ms []Measurement, styles []ReportingStyle, opts fitOptions, n int) {
+	times := make([]float64, n)
+	var first []OptimizationResult
+	for i := range times {
+		start := time.Now()
+		results := make([]OptimizationResult, len(styles))
+		for j, style := range styles {
+			results[j] = fitStyle(ms, style, opts)
+		}
+		times[i] = time.Since(start).Seconds()
+		if first == nil {
+			first = results
+			continue
+		}
+		for j, r := range results {
+			if !sameResult(r, first[j]) {
+				log.Fatalf("run %d of the %s fit gave %v, but run 1 gave %v", i+1, r.Type, r, first[j])
+			}
+		}
+	}
+	avg := average(times)
+	log.Printf("%d runs: mean %v, stddev %v per run", n,
+		time.Duration(avg*float64(time.Second)), time.Duration(stddev(times, avg)*float64(time.Second)))
+}
+
+// Reports whether a and b are the same result, treating NaNs as equal to each other.
+func sameResult(a, b OptimizationResult) bool {
+	same := func(x, y float64) bool {
+		return x == y || math.IsNaN(x) && math.IsNaN(y)
+	}
+	return a.Type == b.Type && same(a.Scale, b.Scale) && same(a.Bias, b.Bias) &&
+		same(a.Error, b.Error) && same(a.ScaleStdErr, b.ScaleStdErr)
+}
+
+// Fits style to ms. Unlike fitStyle, which returns a result with NaN parameters when the data
+// can't be fit, Fit returns an error wrapping ErrInsufficientData if there are fewer than two
+// measurements, ErrInapplicableStyle if the style's transform isn't defined for some of them, or
+// ErrDegenerateInput if the transformed reported values don't determine a line.
+func Fit(ms []Measurement, style ReportingStyle, opts fitOptions) (OptimizationResult, error) {
+	if len(ms) < 2 {
+		return OptimizationResult{}, fmt.Errorf("%s: %w: need at least 2 measurements, got %d",
+			style.Type(), ErrInsufficientData, len(ms))
+	}
+	distinct := false
+	first := style.Apply(ms[0]).Reported
+	for _, m := range ms {
+		x := style.Apply(m).Reported
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return OptimizationResult{}, fmt.Errorf("%s: %w: cannot transform reported value %g",
+				style.Type(), ErrInapplicableStyle, m.Reported)
+		}
+		if x != first {
+			distinct = true
+		}
+	}
+	if !distinct {
+		return OptimizationResult{}, fmt.Errorf("%s: %w: every reported value is %g",
+			style.Type(), ErrDegenerateInput, ms[0].Reported)
+	}
+	r := fits.Fit(ms, style, opts)
+	if math.IsNaN(r.Scale) || math.IsNaN(r.Bias) || math.IsInf(r.Scale, 0) {
+		return r, fmt.Errorf("%s: %w: fit did not produce a finite scale and bias",
+			style.Type(), ErrDegenerateInput)
+	}
+	return r, nil
+}
+
+func fitStyle(ms []Measurement, style ReportingStyle, opts fitOptions) OptimizationResult {
+	scaledMeasurements := make([]Measurement, len(ms))
+	for i, m := range ms {
+		scaledMeasurements[i] = style.Apply(m)
+	}
+	if opts.InverseResidual {
+		// With every measurement on the line there are no residuals to weight by, and the
+		// unweighted fit is already exact.
+		weightInverseResidual(scaledMeasurements)
+	}
+	var scale, bias float64
+	if opts.Anchor != nil {
+		scale, bias = findAnchoredScaleAndBias(scaledMeasurements, style.Apply(*opts.Anchor))
+	} else if opts.TheilSen {
+		scale, bias = findTheilSen(scaledMeasurements)
+	} else if opts.PriorWeight > 0 && opts.PenalizeBias {
+		scale, bias = findPriorScaleAndBias(scaledMeasurements, opts.PriorScale, opts.PriorBias,
+			opts.PriorWeight)
+	} else if opts.PriorWeight > 0 {
+		scale, bias = findRidgeScaleAndBias(scaledMeasurements, opts.PriorScale, opts.PriorWeight)
+	} else if isWeighted(scaledMeasurements) {
+		scale, bias = findWeightedScaleAndBias(scaledMeasurements)
+	} else {
+		scale, bias = findScaleAndBias(scaledMeasurements)
+	}
+	stdError := calculateError(scaledMeasurements, scale, bias)
+	return OptimizationResult{style.Type(), scale, bias, stdError,
+		scaleStdErr(scaledMeasurements, scale, bias)}
+}
+
+// Reports the error that the fit r of style through the origin costs over a fit with a bias, and
+// warns if the bias the measurements imply is significantly different from zero.
+func checkScaleOnly(style ReportingStyle, r OptimizationResult, ms []Measurement) {
+	free := fits.Fit(ms, style, fitOptions{})
+	infof("Fitting the scale only gives an error of %f mm, against %f mm with a bias of %f mm",
+		r.Error, free.Error, free.Bias)
+	if len(ms) <= 2 {
+		return
+	}
+	cov := covariance(style, free, ms)
+	t := free.Bias / math.Sqrt(cov[1][1])
+	if math.Abs(t) > studentTCritical(significanceLevel, float64(len(ms)-2)) {
+		warnf("the measurements imply a nonzero bias of %f mm (t=%.2f), so a scale only "+
+			"calibration will be off by a constant amount", free.Bias, t)
+	}
+}
+
+// Returns the result with the lowest error. Results whose error is NaN, such as those of a style
+// that cannot be applied to the data, are only chosen if nothing else is available.
+func findBestResult(results []OptimizationResult) OptimizationResult {
+	best := results[0]
+	for _, r := range results {
+		if r.Error < best.Error || math.IsNaN(best.Error) && !math.IsNaN(r.Error) {
+			best = r
+		}
+	}
+	return best
+}
+
+// The style -degrade-gracefully falls back to, the simplest idc compatible one.
+const fallbackStyle = "diameter"
+
+// Returns the calibration -degrade-gracefully falls back to when no style could be fit to ms with
+// opts, along with a description of it: fallbackStyle fit without opts, in case they are what
+// made the fit fail, or if even that fails because the reported values are all the same, a
+// calibration that predicts the mean physical size for every contact.
+func degradeResult(ms []Measurement, opts fitOptions) (OptimizationResult, string) {
+	style := lookupStyle(fallbackStyle)
+	if r := fitStyle(ms, style, opts); !math.IsNaN(r.Error) {
+		return r, fmt.Sprintf("%s with error %f", r.Type, r.Error)
+	}
+	if r := fitStyle(ms, style, fitOptions{}); !math.IsNaN(r.Error) {
+		return r, fmt.Sprintf("%s without the fit options, with error %f", r.Type, r.Error)
+	}
+	physical := make([]float64, len(ms))
+	for i, m := range ms {
+		physical[i] = m.Physical
+	}
+	mean := average(physical)
+	r := OptimizationResult{fallbackStyle, 0, mean, stddev(physical, mean), math.NaN()}
+	return r, fmt.Sprintf("a constant %s calibration of %f mm with error %f", r.Type, r.Bias,
+		r.Error)
+}
+
+// The components of a result's -deployable score, which is lower for better results.
+type deployScore struct {
+	Result OptimizationResult
+	// The fit error multiplied by -deploy-error-weight.
+	WeightedError float64
+	// -deploy-penalty if the style can't be written to an idc, otherwise 0.
+	Penalty float64
+	Score   float64
+}
+
+// Scores each result as errorWeight * error, plus penalty if its style isn't idc compatible, and
+// returns the scores with the result scoring lowest. An incompatible style is only chosen if its
+// error is lower than that of every compatible style by more than penalty / errorWeight.
+func findDeployableResult(results []OptimizationResult, errorWeight,
+	penalty float64) (OptimizationResult, []deployScore) {
+	scores := make([]deployScore, len(results))
+	adjusted := make([]OptimizationResult, len(results))
+	for i, r := range results {
+		s := deployScore{Result: r, WeightedError: errorWeight * r.Error}
+		if !lookupStyle(r.Type).IdcCompatible() {
+			s.Penalty = penalty
+		}
+		s.Score = s.WeightedError + s.Penalty
+		scores[i] = s
+		adjusted[i] = r
+		adjusted[i].Error = s.Score
+	}
+	best := findBestResult(adjusted)
+	for _, r := range results {
+		if r.Type == best.Type {
+			return r, scores
+		}
+	}
+	return best, scores
+}
+
+// Prints the components of each result's -deployable score.
+func printDeployScores(scores []deployScore) {
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Style\tError\tWeighted error\tPenalty\tScore")
+	for _, s := range scores {
+		fmt.Fprintf(tw, "%s\t%f\t%f\t%f\t%f\n", s.Result.Type, s.Result.Error, s.WeightedError,
+			s.Penalty, s.Score)
+	}
+	tw.Flush()
+}
+
+// Returns the best result after subtracting bonus from the error of the result of the preferred
+// style, so that it wins near-ties without beating a clearly better fit. The returned result
+// keeps its true error.
+func findPreferredResult(results []OptimizationResult, preferred string,
+	bonus float64) OptimizationResult {
+	adjusted := make([]OptimizationResult, len(results))
+	for i, r := range results {
+		if r.Type == preferred {
+			r.Error -= bonus
+		}
+		adjusted[i] = r
+	}
+	best := findBestResult(adjusted)
+	for _, r := range results {
+		if r.Type == best.Type {
+			return r
+		}
+	}
+	return best
+}
+
+// Returns the best result whose style is idc compatible, or false if there is none.
+func findBestCompatibleResult(results []OptimizationResult) (OptimizationResult, bool) {
+	var compatible []OptimizationResult
+	for _, r := range results {
+		if lookupStyle(r.Type).IdcCompatible() {
+			compatible = append(compatible, r)
+		}
+	}
+	if len(compatible) == 0 {
+		return OptimizationResult{}, false
+	}
+	return findBestResult(compatible), true
 }
 
 func findScaleAndBias(ms []Measurement) (float64, float64) {
@@ -143,6 +1757,108 @@ func findScaleAndBias(ms []Measurement) (float64, float64) {
 	return beta, alpha
 }
 
+// Reports whether any measurement has a weight other than the default of 1.
+func isWeighted(ms []Measurement) bool {
+	for _, m := range ms {
+		if m.Weight != 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Optimize sum(w * (y - alpha - beta * x)^2), where x = Reported, y = Physical and w = Weight.
+// With weighted means xw and yw, beta = sum(w * (x - xw) * (y - yw)) / sum(w * (x - xw)^2).
+func findWeightedScaleAndBias(ms []Measurement) (float64, float64) {
+	avgReport, avgPhysical := weightedMeans(ms)
+	num, denom := float64(0), float64(0)
+	for _, m := range ms {
+		dx := m.Reported - avgReport
+		num += m.Weight * dx * (m.Physical - avgPhysical)
+		denom += m.Weight * dx * dx
+	}
+	beta := num / denom
+	alpha := avgPhysical - beta*avgReport
+	return beta, alpha
+}
+
+// Optimize sum(w * (y - alpha - beta * x)^2) + lambda * (beta - prior)^2. Setting the
+// derivatives to zero gives alpha = yw - beta * xw as in the weighted fit, and
+// beta = (sum(w * (x - xw) * (y - yw)) + lambda * prior) / (sum(w * (x - xw)^2) + lambda).
+func findRidgeScaleAndBias(ms []Measurement, prior, lambda float64) (float64, float64) {
+	avgReport, avgPhysical := weightedMeans(ms)
+	num, denom := lambda*prior, lambda
+	for _, m := range ms {
+		dx := m.Reported - avgReport
+		num += m.Weight * dx * (m.Physical - avgPhysical)
+		denom += m.Weight * dx * dx
+	}
+	beta := num / denom
+	alpha := avgPhysical - beta*avgReport
+	return beta, alpha
+}
+
+// Optimize sum(w * (y - alpha - beta * x)^2) + lambda * ((beta - b0)^2 + (alpha - a0)^2), a
+// Tikhonov regularized least squares pulling both coefficients towards the prior (a0, b0).
+// Setting the partial derivatives to zero gives the normal equations
+//
+//	(sum(w) + lambda) * alpha + sum(w * x) * beta = sum(w * y) + lambda * a0
+//	sum(w * x) * alpha + (sum(w * x^2) + lambda) * beta = sum(w * x * y) + lambda * b0
+//
+// which are solved by Cramer's rule.
+func findPriorScaleAndBias(ms []Measurement, b0, a0, lambda float64) (float64, float64) {
+	sw, swx, swxx, swy, swxy := lambda, float64(0), lambda, lambda*a0, lambda*b0
+	for _, m := range ms {
+		sw += m.Weight
+		swx += m.Weight * m.Reported
+		swxx += m.Weight * m.Reported * m.Reported
+		swy += m.Weight * m.Physical
+		swxy += m.Weight * m.Reported * m.Physical
+	}
+	det := sw*swxx - swx*swx
+	alpha := (swy*swxx - swx*swxy) / det
+	beta := (sw*swxy - swx*swy) / det
+	return beta, alpha
+}
+
+// Returns the weighted means of the reported and physical values of ms.
+func weightedMeans(ms []Measurement) (avgReport, avgPhysical float64) {
+	sumWeight := float64(0)
+	for _, m := range ms {
+		avgReport += m.Weight * m.Reported
+		avgPhysical += m.Weight * m.Physical
+		sumWeight += m.Weight
+	}
+	return avgReport / sumWeight, avgPhysical / sumWeight
+}
+
+// Optimize y = alpha + beta * x subject to the line passing through the anchor point (x0, y0).
+// Substituting alpha = y0 - beta * x0 leaves a single free parameter, which has the closed
+// form beta = sum(w * (x - x0) * (y - y0)) / sum(w * (x - x0)^2).
+func findAnchoredScaleAndBias(ms []Measurement, anchor Measurement) (float64, float64) {
+	num, denom := float64(0), float64(0)
+	for _, m := range ms {
+		dx := m.Reported - anchor.Reported
+		dy := m.Physical - anchor.Physical
+		num += m.Weight * dx * dy
+		denom += m.Weight * dx * dx
+	}
+	beta := num / denom
+	alpha := anchor.Physical - beta*anchor.Reported
+	return beta, alpha
+}
+
+// Optimize y = alpha + beta * x with beta fixed at scale, which gives alpha as the weighted mean
+// of y - scale * x.
+func findBiasForScale(ms []Measurement, scale float64) float64 {
+	sum, sumWeight := float64(0), float64(0)
+	for _, m := range ms {
+		sum += m.Weight * (m.Physical - scale*m.Reported)
+		sumWeight += m.Weight
+	}
+	return sum / sumWeight
+}
+
 func calculateError(ms []Measurement, scale, bias float64) float64 {
 	sum := float64(0)
 	for _, m := range ms {
@@ -169,3 +1885,55 @@ func stddev(nums []float64, avg float64) float64 {
 	}
 	return math.Sqrt(sum / float64(len(nums)))
 }
+
+// Parses a pair of comma separated floats such as "100,5.0".
+func parsePair(s string) (float64, float64, error) {
+	vals, err := parseFloatList(s, ",", 2)
+	if err != nil {
+		return 0, 0, err
+	}
+	return vals[0], vals[1], nil
+}
+
+// An inclusive range of values.
+type valueRange struct {
+	Lo, Hi float64
+}
+
+func (r valueRange) Contains(v float64) bool {
+	return v >= r.Lo && v <= r.Hi
+}
+
+// Parses a "lo:hi" range.
+func parseRange(s string) (valueRange, error) {
+	vals, err := parseFloatList(s, ":", 2)
+	if err != nil {
+		return valueRange{}, err
+	}
+	if vals[0] > vals[1] {
+		return valueRange{}, fmt.Errorf("lo %g is greater than hi %g", vals[0], vals[1])
+	}
+	return valueRange{vals[0], vals[1]}, nil
+}
+
+// Parses a comma separated list of any number of floats.
+func parseFloats(s string) ([]float64, error) {
+	return parseFloatList(s, ",", strings.Count(s, ",")+1)
+}
+
+// Parses exactly n floats separated by sep, such as "15:18:0.5".
+func parseFloatList(s, sep string, n int) ([]float64, error) {
+	parts := strings.Split(s, sep)
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d values separated by %q, got %q", n, sep, s)
+	}
+	vals := make([]float64, n)
+	for i, part := range parts {
+		val, err := parseNumber(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return vals, nil
+}
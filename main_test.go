@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The tolerance within which fitted values must match the hand-derived ones.
+const testTolerance = 1e-6
+
+// Checks that the idc properties in got match those in want, with numeric values compared
+// within testTolerance and everything else exactly.
+func idcMatches(t *testing.T, got, want string) {
+	t.Helper()
+	var gotProps, wantProps []idcProperty
+	for _, line := range strings.Split(got, "\n") {
+		if p, ok := parseIDCProperty(line); ok {
+			gotProps = append(gotProps, p)
+		}
+	}
+	for _, line := range strings.Split(want, "\n") {
+		if p, ok := parseIDCProperty(line); ok {
+			wantProps = append(wantProps, p)
+		}
+	}
+	if len(gotProps) != len(wantProps) {
+		t.Fatalf("idc has %d properties, want %d:\n%s", len(gotProps), len(wantProps), got)
+	}
+	for i, want := range wantProps {
+		got := gotProps[i]
+		if got.Key != want.Key {
+			t.Errorf("property %d is %s, want %s", i, got.Key, want.Key)
+			continue
+		}
+		a, aerr := strconv.ParseFloat(got.Value, 64)
+		b, berr := strconv.ParseFloat(want.Value, 64)
+		if aerr == nil && berr == nil {
+			if math.Abs(a-b) > testTolerance {
+				t.Errorf("%s = %s, want %s", got.Key, got.Value, want.Value)
+			}
+		} else if got.Value != want.Value {
+			t.Errorf("%s = %s, want %s", got.Key, got.Value, want.Value)
+		}
+	}
+}
+
+// Fits datasets whose calibrations were derived by hand and checks the idc written for them,
+// pinning the contract between a style's transform, the dpi scaling and the idc keys.
+func TestStyleIDCGolden(t *testing.T) {
+	tests := []struct {
+		style       string
+		physical    []float64
+		reported    []float64
+		scale, bias float64
+		idc         string
+	}{
+		{
+			// physical = 2 * reported + 1, so at 10 dots per mm the pixel scale is 20 and the
+			// pixel bias 10.
+			style:    "diameter",
+			physical: []float64{3, 5, 7, 9},
+			reported: []float64{1, 2, 3, 4},
+			scale:    2,
+			bias:     1,
+			idc: "touch.size.calibration = diameter\n" +
+				"touch.size.scale = 20.000000\n" +
+				"touch.size.bias = 10.000000\n",
+		},
+		{
+			// physical = 3 * sqrt(reported) - 1, on perfect squares so the square roots are
+			// exact: a pixel scale of 30 and a pixel bias of -10.
+			style:    "area",
+			physical: []float64{2, 5, 8, 11},
+			reported: []float64{1, 4, 9, 16},
+			scale:    3,
+			bias:     -1,
+			idc: "touch.size.calibration = area\n" +
+				"touch.size.scale = 30.000000\n" +
+				"touch.size.bias = -10.000000\n",
+		},
+	}
+	defer func(old bool) { *minimalIDC = old }(*minimalIDC)
+	*minimalIDC = true
+	for _, test := range tests {
+		t.Run(test.style, func(t *testing.T) {
+			ms := make([]Measurement, len(test.physical))
+			for i := range ms {
+				ms[i] = Measurement{Physical: test.physical[i], Reported: test.reported[i], Weight: 1}
+			}
+			r := fitStyle(ms, lookupStyle(test.style), fitOptions{})
+			if math.Abs(r.Scale-test.scale) > testTolerance ||
+				math.Abs(r.Bias-test.bias) > testTolerance {
+				t.Errorf("fit scale %f, bias %f, want %f, %f", r.Scale, r.Bias, test.scale,
+					test.bias)
+			}
+			var b strings.Builder
+			if err := writeIDC(&b, calibration{r, 10, ms, nil, fitOptions{}}); err != nil {
+				t.Fatal(err)
+			}
+			idcMatches(t, b.String(), test.idc)
+		})
+	}
+}
+
+// A naive two-pass reference for average and stddev: the mean, then the root mean square
+// deviation from it.
+func referenceMeanStddev(nums []float64) (float64, float64) {
+	sum := 0.0
+	for _, x := range nums {
+		sum += x
+	}
+	mean := sum / float64(len(nums))
+	ss := 0.0
+	for _, x := range nums {
+		ss += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(nums)))
+}
+
+func TestAverageStddev(t *testing.T) {
+	tests := []struct {
+		name string
+		nums []float64
+		// The exact standard deviation, or NaN to only compare against the reference.
+		stddev float64
+	}{
+		{"single", []float64{4}, 0},
+		{"constant", []float64{2.5, 2.5, 2.5}, 0},
+		{"small", []float64{1, 2, 3, 4}, math.Sqrt(1.25)},
+		{"negative", []float64{-3, -1, 1, 3}, math.Sqrt(5)},
+		{"fractions", []float64{0.1, 0.2, 0.3, 0.4, 0.5}, math.NaN()},
+		// Large values with a small spread, where a one-pass sum of squares cancels.
+		{"large", []float64{1e9 + 1, 1e9 + 2, 1e9 + 3}, math.Sqrt(2.0 / 3)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wantMean, wantStddev := referenceMeanStddev(test.nums)
+			mean := average(test.nums)
+			sd := stddev(test.nums, mean)
+			if math.Abs(mean-wantMean) > 1e-9*math.Max(1, math.Abs(wantMean)) {
+				t.Errorf("average = %.17g, want %.17g", mean, wantMean)
+			}
+			if math.Abs(sd-wantStddev) > 1e-9 {
+				t.Errorf("stddev = %.17g, want %.17g from the reference", sd, wantStddev)
+			}
+			if !math.IsNaN(test.stddev) && math.Abs(sd-test.stddev) > 1e-9 {
+				t.Errorf("stddev = %.17g, want exactly %.17g", sd, test.stddev)
+			}
+		})
+	}
+}
+
+// Returns the style column of a -all table printed without a header.
+func tableTypes(table string) []string {
+	var types []string
+	for _, line := range strings.Split(strings.TrimSpace(table), "\n") {
+		types = append(types, strings.Fields(line)[0])
+	}
+	return types
+}
+
+// The -all table must list the styles in a fixed order: registration order unsorted, and for a
+// metric, ties in the input order whichever the direction, with unfit styles last.
+func TestAllTableDeterministic(t *testing.T) {
+	ms := testMeasurements(12, 1)
+	// More ties than the 12 elements up to which the sort package's unstable sort is an
+	// insertion sort, which would keep them in order anyway.
+	var tied []OptimizationResult
+	var ties []string
+	for i := 0; i < 20; i++ {
+		ties = append(ties, fmt.Sprintf("tie%02d", 19-i))
+		tied = append(tied, OptimizationResult{Type: ties[i], Error: 0.2})
+		if i == 5 {
+			tied = append(tied, OptimizationResult{Type: "unfit", Error: math.NaN()})
+		}
+	}
+	tied = append(tied, OptimizationResult{Type: "best", Error: 0.1})
+	byName := append([]string{"best"}, ties...)
+	sort.Strings(byName)
+	byName = append(byName, "unfit")
+	tests := []struct {
+		name    string
+		results []OptimizationResult
+		order   string
+		reverse bool
+		want    []string
+	}{
+		{"registered", fitStyles(ms, Styles, fitOptions{}), "registered", false,
+			[]string{"diameter", "area"}},
+		{"registered reversed", fitStyles(ms, Styles, fitOptions{}), "registered", true,
+			[]string{"area", "diameter"}},
+		{"error ties", tied, "error", false, append(append([]string{"best"}, ties...), "unfit")},
+		{"error ties reversed", tied, "error", true, append(append(ties[:len(ties):len(ties)],
+			"best"), "unfit")},
+		{"name", tied, "name", false, byName},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sorted, err := sortResults(test.results, ms, test.order, test.reverse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tableTypes(captureStdout(t, func() { printResultsTable(sorted, false) }))
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("the -all table lists %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// A fitted calibration, ready to be written out in one of the output formats.
+type calibration struct {
+	Result       OptimizationResult
+	Dpi          float64
+	Measurements []Measurement
+	// The results of every style that was fit, of which Result won, or nil if they're unknown.
+	Results []OptimizationResult
+	// The options the results were fit with.
+	Options fitOptions
+}
+
+// The scale converted from mm to pixels.
+func (c calibration) Scale() float64 {
+	return c.Dpi * c.Result.Scale
+}
+
+// The bias converted from mm to pixels.
+func (c calibration) Bias() float64 {
+	return c.Dpi * c.Result.Bias
+}
+
+// The output formats selectable with -format, keyed by name.
+var formats = map[string]func(w io.Writer, c calibration) error{
+	"text":    writeText,
+	"idc":     writeIDC,
+	"json":    writeJSON,
+	"ratio":   writeRatio,
+	"shell":   writeShell,
+	"cheader": writeCHeader,
+	"python":  writePython,
+	"plist":   writePlist,
+	"badge":   writeBadge,
+	"fixed":   writeFixed,
+}
+
+// The formats meant to be parsed by another program, which infof keeps out of stdout.
+var structuredFormats = map[string]bool{
+	"json":    true,
+	"plist":   true,
+	"python":  true,
+	"cheader": true,
+}
+
+// The formats that write a touch.size.calibration, which only idc compatible styles have.
+var idcFormats = map[string]bool{
+	"idc":   true,
+	"ratio": true,
+	"fixed": true,
+	"shell": true,
+}
+
+func formatNames() string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Writes c in the named format to path, or to stdout if path is empty.
+func emitCalibration(path, format string, c calibration) error {
+	write, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, expected one of %s", format, formatNames())
+	}
+	if path == "" {
+		return write(os.Stdout, c)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f, c)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// The version of scali, set at build time with -ldflags "-X main.version=...".
+var version = "devel"
+
+// Returns the lines that -emit-meta adds to an output to describe how it was produced: the
+// version of scali, the time and the command line.
+func metaLines() []string {
+	args := make([]string, len(os.Args))
+	for i, arg := range os.Args {
+		args[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`*?;&|<>()") {
+			args[i] = strconv.Quote(arg)
+		}
+	}
+	return []string{
+		"scali " + version,
+		"generated " + time.Now().UTC().Format(time.RFC3339),
+		"command: " + strings.Join(args, " "),
+	}
+}
+
+// Writes the metaLines to w, each after prefix, if -emit-meta is set.
+func writeMeta(w io.Writer, prefix string) {
+	if !*emitMeta {
+		return
+	}
+	for _, line := range metaLines() {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+}
+
+// Writes an empty calibration in format to path, or stdout if path is empty, recording that
+// calibrating failed with msg.
+func emitFailure(path, format, msg string) error {
+	if _, ok := formats[format]; !ok {
+		return fmt.Errorf("unknown format %q, expected one of %s", format, formatNames())
+	}
+	var b bytes.Buffer
+	switch format {
+	case "json":
+		encodeJSON(&b, struct {
+			Error string `json:"error"`
+		}{msg})
+	case "cheader":
+		fmt.Fprintf(&b, "/* Touch size calibration failed: %s */\n", strings.ReplaceAll(msg, "*/", "* /"))
+	default:
+		fmt.Fprintf(&b, "# Touch size calibration failed: %s\n", strings.ReplaceAll(msg, "\n", " "))
+	}
+	if path == "" {
+		_, err := os.Stdout.Write(b.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0666)
+}
+
+// Writes the -keep-all results as CSV to path, with a header row. The confidence interval columns
+// are empty when there were too few measurements to estimate them.
+func writeKeptResultsCSV(path string, kept []keptResult) error {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "type,scale,bias,error,r2,scale_lo,scale_hi,bias_lo,bias_hi,selected")
+	for _, k := range kept {
+		scaleCI, biasCI := ",", ","
+		if k.ScaleCI != nil {
+			scaleCI = fmt.Sprintf("%f,%f", k.ScaleCI[0], k.ScaleCI[1])
+			biasCI = fmt.Sprintf("%f,%f", k.BiasCI[0], k.BiasCI[1])
+		}
+		fmt.Fprintf(&b, "%s,%f,%f,%f,%f,%s,%s,%t\n", k.Type, k.Scale, k.Bias, k.Error, k.R2, scaleCI,
+			biasCI, k.Selected)
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0666)
+}
+
+func writeText(w io.Writer, c calibration) error {
+	if *scaleOnly {
+		_, err := fmt.Fprintf(w, "Scale=%s\n", formatScale(c.Scale()))
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Bias=%s, Scale=%s\n", formatBias(c.Bias()), formatScale(c.Scale()))
+	return err
+}
+
+// Formats an emitted scale with -scale-precision digits, or -precision if that isn't set.
+func formatScale(v float64) string {
+	if *scalePrecision >= 0 {
+		return formatDecimal(v, *scalePrecision)
+	}
+	return formatDecimal(v, *precision)
+}
+
+// Formats an emitted bias with -bias-precision digits, or -precision if that isn't set.
+func formatBias(v float64) string {
+	if *biasPrecision >= 0 {
+		return formatDecimal(v, *biasPrecision)
+	}
+	return formatDecimal(v, *precision)
+}
+
+// Formats v with prec digits after the decimal point. Unlike %f the result always contains a
+// decimal point, even with a precision of 0, so that parsers expecting a float accept it.
+// strconv never consults the locale, so the point is always '.'.
+func formatDecimal(v float64, prec int) string {
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+	if !strings.ContainsAny(s, ".NI") {
+		s += ".0"
+	}
+	return s
+}
+
+// Writes the calibration as a shell snippet of setprop commands, using the property names given
+// by -shell-props. With -scale-only there is no bias to set, so the bias name may be left out and
+// is ignored if it is given.
+func writeShell(w io.Writer, c calibration) error {
+	names := strings.Split(*shellProps, ",")
+	if *scaleOnly && len(names) == 2 {
+		names = append(names, "")
+	}
+	if len(names) != 3 {
+		return fmt.Errorf("-shell-props needs calibration, scale and bias names, got %q", *shellProps)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Touch size calibration generated by scali\n")
+	fmt.Fprintf(&b, "setprop %s %s\n", names[0], c.Result.Type)
+	fmt.Fprintf(&b, "setprop %s %s\n", names[1], formatScale(c.Scale()))
+	if !*scaleOnly {
+		fmt.Fprintf(&b, "setprop %s %s\n", names[2], formatBias(c.Bias()))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Writes the calibration as a C header of #define constants named with -define-prefix, for
+// firmware that bakes the calibration in at build time.
+func writeCHeader(w io.Writer, c calibration) error {
+	if !cIdentifier.MatchString(*definePrefix) {
+		return fmt.Errorf("-define-prefix %q is not a valid C identifier", *definePrefix)
+	}
+	scale, err := cFloatLiteral(formatScale(c.Scale()))
+	if err != nil {
+		return fmt.Errorf("scale: %v", err)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "/* Touch size calibration generated by scali. */\n")
+	fmt.Fprintf(&b, "/* Style: %s */\n", c.Result.Type)
+	fmt.Fprintf(&b, "#define %s_SCALE %s\n", *definePrefix, scale)
+	if !*scaleOnly {
+		bias, err := cFloatLiteral(formatBias(c.Bias()))
+		if err != nil {
+			return fmt.Errorf("bias: %v", err)
+		}
+		fmt.Fprintf(&b, "#define %s_BIAS %s\n", *definePrefix, bias)
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+var cIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Writes the measurements and the fit as a Python snippet defining numpy arrays and the fitted
+// coefficients, for analysis to carry on in Python. Floats are written in their shortest exact
+// form so the snippet is deterministic.
+func writePython(w io.Writer, c calibration) error {
+	style := lookupStyle(c.Result.Type)
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Touch size calibration generated by scali\n")
+	fmt.Fprintf(&b, "import numpy as np\n\n")
+	fmt.Fprintf(&b, "# Style %s: %s.\n", c.Result.Type, style.Description())
+	if *scaleOnly {
+		fmt.Fprintf(&b, "# physical = scale * %s(reported), in mm.\n", c.Result.Type)
+	} else {
+		fmt.Fprintf(&b, "# physical = scale * %s(reported) + bias, in mm.\n", c.Result.Type)
+	}
+	writePythonArray(&b, "reported", c.Measurements, func(m Measurement) float64 { return m.Reported })
+	writePythonArray(&b, "physical", c.Measurements, func(m Measurement) float64 { return m.Physical })
+	if isWeighted(c.Measurements) {
+		writePythonArray(&b, "weight", c.Measurements, func(m Measurement) float64 { return m.Weight })
+	}
+	fmt.Fprintf(&b, "scale = %s\n", pythonFloat(c.Result.Scale))
+	if !*scaleOnly {
+		fmt.Fprintf(&b, "bias = %s\n", pythonFloat(c.Result.Bias))
+	}
+	fmt.Fprintf(&b, "error = %s\n", pythonFloat(c.Result.Error))
+	fmt.Fprintf(&b, "dpi = %s\n", pythonFloat(c.Dpi))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writePythonArray(w io.Writer, name string, ms []Measurement, field func(Measurement) float64) {
+	vals := make([]string, len(ms))
+	for i, m := range ms {
+		vals[i] = pythonFloat(field(m))
+	}
+	fmt.Fprintf(w, "%s = np.array([%s], dtype=float)\n", name, strings.Join(vals, ", "))
+}
+
+// Formats v as a Python float literal, using the shortest representation that round-trips.
+func pythonFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "float('nan')"
+	case math.IsInf(v, 1):
+		return "float('inf')"
+	case math.IsInf(v, -1):
+		return "float('-inf')"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Writes a one line quality verdict for dashboards: PASS if the error is within the lower of the
+// -badge-thresholds, REVIEW if it's within the upper, otherwise FAIL, followed by the error and
+// R² behind it.
+func writeBadge(w io.Writer, c calibration) error {
+	bands, err := parseRange(*badgeThresholds)
+	if err != nil {
+		return fmt.Errorf("invalid -badge-thresholds: %v", err)
+	}
+	status := "FAIL"
+	switch {
+	case c.Result.Error <= bands.Lo:
+		status = "PASS"
+	case c.Result.Error <= bands.Hi:
+		status = "REVIEW"
+	}
+	r2 := computeStats(lookupStyle(c.Result.Type), c.Result, c.Measurements).R2
+	_, err = fmt.Fprintf(w, "%s error=%f r2=%f\n", status, c.Result.Error, r2)
+	return err
+}
+
+// Returns the decimal s, as formatted by formatDecimal, as a C float literal.
+func cFloatLiteral(s string) (string, error) {
+	if strings.ContainsAny(s, "NI") {
+		return "", fmt.Errorf("%s has no C float literal", s)
+	}
+	return s + "f", nil
+}
+
+// Writes the calibration as idc keys whose values are integer ratios, for input stacks that can
+// only parse integers. The exact values are kept in comments for reference.
+func writeRatio(w io.Writer, c calibration) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "touch.size.calibration = %s\n", c.Result.Type)
+	writeRatioKey(&b, "touch.size.scale", c.Scale(), formatScale(c.Scale()))
+	if !*scaleOnly {
+		writeRatioKey(&b, "touch.size.bias", c.Bias(), formatBias(c.Bias()))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Writes the calibration as idc keys whose values are Q-format fixed point: the pixel scale and
+// bias multiplied by 2^frac-bits and rounded to the nearest signed 32 bit integer. The shift,
+// the representable range and the quantization error of each value are kept in comments.
+func writeFixed(w io.Writer, c calibration) error {
+	bits := *fracBits
+	if bits < 0 || bits > 31 {
+		return fmt.Errorf("-frac-bits must be from 0 to 31, got %d", bits)
+	}
+	one := math.Ldexp(1, bits)
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Q%d.%d fixed point: values are integers / 2^%d, from %g to %g\n", 31-bits,
+		bits, bits, math.MinInt32/one, math.MaxInt32/one)
+	fmt.Fprintf(&b, "touch.size.frac_bits = %d\n", bits)
+	fmt.Fprintf(&b, "touch.size.calibration = %s\n", c.Result.Type)
+	keys := []string{"touch.size.scale", "touch.size.bias"}
+	values := []float64{c.Scale(), c.Bias()}
+	if *scaleOnly {
+		keys, values = keys[:1], values[:1]
+	}
+	for i, key := range keys {
+		q := math.Round(values[i] * one)
+		if q < math.MinInt32 || q > math.MaxInt32 {
+			return fmt.Errorf("%s %f is outside the range of Q%d.%d; lower -frac-bits", key,
+				values[i], 31-bits, bits)
+		}
+		fmt.Fprintf(&b, "# %s = %f, quantization error %g\n", key, values[i],
+			math.Abs(q/one-values[i]))
+		fmt.Fprintf(&b, "%s = %d\n", key, int32(q))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeRatioKey(w io.Writer, key string, value float64, formatted string) {
+	num, denom := approximateRatio(value, *maxDenominator)
+	approxErr := math.Abs(float64(num)/float64(denom) - value)
+	fmt.Fprintf(w, "# %s = %s, approximation error %g\n", key, formatted, approxErr)
+	fmt.Fprintf(w, "%s = %d/%d\n", key, num, denom)
+}
+
+// Returns the fraction num/denom closest to x with 0 < denom <= maxDenom, found by walking the
+// continued fraction expansion of x and then trying the best semiconvergent once the next
+// convergent's denominator would exceed maxDenom.
+func approximateRatio(x float64, maxDenom int64) (num, denom int64) {
+	sign := int64(1)
+	if x < 0 {
+		sign, x = -1, -x
+	}
+	// p0/q0 and p1/q1 are the two most recent convergents.
+	p0, q0, p1, q1 := int64(0), int64(1), int64(1), int64(0)
+	frac := x
+	for {
+		a := math.Floor(frac)
+		if a > math.MaxInt32 {
+			break
+		}
+		q2 := q0 + int64(a)*q1
+		if q2 > maxDenom {
+			break
+		}
+		p0, q0, p1, q1 = p1, q1, p0+int64(a)*p1, q2
+		if frac == a {
+			return sign * p1, q1
+		}
+		frac = 1 / (frac - a)
+	}
+	if q1 == 0 {
+		// Even the first convergent's denominator exceeded maxDenom, so x is too large to be
+		// approximated; fall back to rounding.
+		return sign * int64(math.Round(x)), 1
+	}
+	k := (maxDenom - q0) / q1
+	semiNum, semiDenom := p0+k*p1, q0+k*q1
+	if math.Abs(float64(semiNum)/float64(semiDenom)-x) < math.Abs(float64(p1)/float64(q1)-x) {
+		return sign * semiNum, semiDenom
+	}
+	return sign * p1, q1
+}
+
+// Parses a "lo:hi:step" range.
+func parseSweep(s string) (lo, hi, step float64, err error) {
+	vals, err := parseFloatList(s, ":", 3)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	lo, hi, step = vals[0], vals[1], vals[2]
+	if step <= 0 {
+		return 0, 0, 0, fmt.Errorf("step must be positive, got %g", step)
+	}
+	if lo > hi {
+		return 0, 0, 0, fmt.Errorf("lo %g is greater than hi %g", lo, hi)
+	}
+	return lo, hi, step, nil
+}
+
+// Returns each dpi in [lo, hi] at the given step.
+func sweepDpis(lo, hi, step float64) []float64 {
+	// Count the steps rather than accumulating dpi so rounding doesn't drop the last one.
+	steps := int(math.Floor((hi-lo)/step + 1e-9))
+	dpis := make([]float64, steps+1)
+	for i := range dpis {
+		dpis[i] = lo + float64(i)*step
+	}
+	return dpis
+}
+
+// Writes the physical size that the fit r of style predicts for each reported value in [lo, hi]
+// at the given step as CSV rows of "reported,physical". Rows are streamed to w as they are
+// computed, so fine steps over a wide range don't need to be held in memory.
+func writeCurve(w io.Writer, style ReportingStyle, r OptimizationResult, lo, hi, step float64) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "reported,physical")
+	// Count the steps rather than accumulating the reported value, as in sweepDpis.
+	steps := int(math.Floor((hi-lo)/step + 1e-9))
+	for i := 0; i <= steps; i++ {
+		x := lo + float64(i)*step
+		if _, err := fmt.Fprintf(bw, "%g,%f\n", x, Predict(style, r, x)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Prints a table of the pixel scale and bias that r would be emitted with at each dpi.
+func printDpiTable(r OptimizationResult, dpis []float64) {
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "DPI\tScale\tBias")
+	for _, dpi := range dpis {
+		fmt.Fprintf(tw, "%f\t%s\t%s\n", dpi, formatScale(dpi*r.Scale), formatBias(dpi*r.Bias))
+	}
+	tw.Flush()
+}
+
+// Returns a copy of results ordered by key, ascending or with reverse descending: one of the
+// resultMetrics, which puts results that couldn't be fit last either way, "name" or "type" for
+// style type, or "registered" for the order styles were fit in.
+func sortResults(results []OptimizationResult, ms []Measurement, key string,
+	reverse bool) ([]OptimizationResult, error) {
+	sorted := make([]OptimizationResult, len(results))
+	copy(sorted, results)
+	var less func(a, b OptimizationResult) bool
+	switch key {
+	case "name", "type":
+		less = func(a, b OptimizationResult) bool {
+			if reverse {
+				return a.Type > b.Type
+			}
+			return a.Type < b.Type
+		}
+	case "registered":
+		if reverse {
+			for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+				sorted[i], sorted[j] = sorted[j], sorted[i]
+			}
+		}
+		return sorted, nil
+	default:
+		metric, ok := resultMetrics[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort order %q, expected error, rms, mae, r2, max, "+
+				"name, type or registered", key)
+		}
+		values := make(map[string]float64, len(results))
+		for _, r := range results {
+			values[r.Type] = metric(r, ms)
+		}
+		less = func(a, b OptimizationResult) bool {
+			va, vb := values[a.Type], values[b.Type]
+			// NaN, from a style that couldn't be fit, sorts last in either direction.
+			if math.IsNaN(va) || math.IsNaN(vb) {
+				return !math.IsNaN(va) && math.IsNaN(vb)
+			}
+			if reverse {
+				return va > vb
+			}
+			return va < vb
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted, nil
+}
+
+// The per style metrics the results can be sorted by, keyed by -sort-output name.
+var resultMetrics = map[string]func(r OptimizationResult, ms []Measurement) float64{
+	"error": func(r OptimizationResult, ms []Measurement) float64 { return r.Error },
+	"rms":   func(r OptimizationResult, ms []Measurement) float64 { return r.Error },
+	"mae": func(r OptimizationResult, ms []Measurement) float64 {
+		return computeStats(lookupStyle(r.Type), r, ms).MAE
+	},
+	"r2": func(r OptimizationResult, ms []Measurement) float64 {
+		return computeStats(lookupStyle(r.Type), r, ms).R2
+	},
+	"max": func(r OptimizationResult, ms []Measurement) float64 {
+		return computeStats(lookupStyle(r.Type), r, ms).MaxError
+	},
+}
+
+// Prints a table of every style's fit, with a header row unless header is false.
+func printResultsTable(results []OptimizationResult, header bool) {
+	if header {
+		writeMeta(os.Stdout, "# ")
+	}
+	tw := newTable(os.Stdout)
+	if header {
+		fmt.Fprintln(tw, "Style\tScale\tBias\tError")
+	}
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%f\t%f\t%f\n", r.Type, r.Scale, r.Bias, r.Error)
+	}
+	tw.Flush()
+}
+
+// Returns a writer that aligns tab separated columns, for printing tables.
+func newTable(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+}
+
+// Prints the weight each measurement carries in the fit.
+func printWeights(ms []Measurement) {
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Physical\tReported\tWeight")
+	for _, m := range ms {
+		fmt.Fprintf(tw, "%f\t%f\t%f\n", m.Physical, m.Reported, m.Weight)
+	}
+	tw.Flush()
+}
+
+// Prints each measurement's residual in both mm and pixels, followed by the RMS error in each.
+// A residual of d mm corresponds to d * dpi pixels, with dpi in dots per mm.
+func printPixelResiduals(style ReportingStyle, r OptimizationResult, ms []Measurement, dpi float64) {
+	ms = sortedByReported(ms)
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Physical\tReported\tResidual (mm)\tResidual (px)")
+	for i, res := range residuals(style, r, ms) {
+		fmt.Fprintf(tw, "%f\t%f\t%f\t%f\n", ms[i].Physical, ms[i].Reported, res, res*dpi)
+	}
+	tw.Flush()
+	fmt.Printf("RMS error: %f mm, %f px\n", r.Error, r.Error*dpi)
+}
+
+// Prints how the emitted scale and bias of c follow from the fitted ones: the fit relates reported
+// units to mm, while the input stack expects pixels, so both are multiplied by the dpi of the
+// panel, which came from source.
+func printDpiExplanation(c calibration, source string) {
+	fmt.Printf("Fitted scale %f mm per reported unit and bias %f mm\n", c.Result.Scale,
+		c.Result.Bias)
+	fmt.Printf("Converted to pixels at %g dots per mm, from %s\n", c.Dpi, source)
+	fmt.Printf("Emitted scale = %f * %g = %s\n", c.Result.Scale, c.Dpi, formatScale(c.Scale()))
+	fmt.Printf("Emitted bias = %f * %g = %s\n", c.Result.Bias, c.Dpi, formatBias(c.Bias()))
+}
+
+// Prints the dpi at which the fitted scale of r would be emitted as the pixel scale target, and
+// how well the measurements fit when the scale is held at target instead, with the bias refit.
+func printTargetScale(ms []Measurement, style ReportingStyle, r OptimizationResult, dpi,
+	target float64) {
+	scaled := make([]Measurement, len(ms))
+	for i, m := range ms {
+		scaled[i] = style.Apply(m)
+	}
+	scale := target / dpi
+	bias := findBiasForScale(scaled, scale)
+	fmt.Printf("Target pixel scale %f implies dpi %f; dpi %f gives pixel scale %f\n",
+		target, target/r.Scale, dpi, dpi*r.Scale)
+	fmt.Printf("Error at fitted scale: %f mm\n", r.Error)
+	fmt.Printf("Error at target scale: %f mm, with bias refit to %f (pixel bias %f)\n",
+		calculateError(scaled, scale, bias), bias, dpi*bias)
+}
+
+// Prints the type and description of each style and whether it is idc compatible.
+func printStyles(styles []ReportingStyle) {
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Style\tIdc\tDescription")
+	for _, style := range styles {
+		compatible := "no"
+		if style.IdcCompatible() {
+			compatible = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", style.Type(), compatible, style.Description())
+	}
+	tw.Flush()
+}
+
+// Prints the normal equations XᵀWX [scale bias]ᵀ = XᵀWy that least squares solves for style,
+// where each row of X is (transformed reported value, 1), y holds the physical sizes and W the
+// weights, which are all 1 for unweighted input.
+func printNormalEquations(style ReportingStyle, ms []Measurement) {
+	var sw, sx, sxx, sy, sxy float64
+	for _, m := range ms {
+		m = style.Apply(m)
+		sw += m.Weight
+		sx += m.Weight * m.Reported
+		sxx += m.Weight * m.Reported * m.Reported
+		sy += m.Weight * m.Physical
+		sxy += m.Weight * m.Reported * m.Physical
+	}
+	fmt.Printf("Normal equations for %s, with rows and columns ordered scale, bias:\n", style.Type())
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "XᵀWX\t\t\tXᵀWy")
+	fmt.Fprintf(tw, "%g\t%g\t\t%g\n", sxx, sx, sxy)
+	fmt.Fprintf(tw, "%g\t%g\t\t%g\n", sx, sw, sy)
+	tw.Flush()
+}
+
+// Prints cov, the covariance matrix of the fitted scale and bias, with the scale first.
+func printCovariance(cov [2][2]float64) {
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Covariance\tScale\tBias")
+	fmt.Fprintf(tw, "Scale\t%g\t%g\n", cov[0][0], cov[0][1])
+	fmt.Fprintf(tw, "Bias\t%g\t%g\n", cov[1][0], cov[1][1])
+	tw.Flush()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Under -scale-only every format but json must leave the bias out; json keeps its fixed schema,
+// where the bias is a zero that consumers can ignore.
+func TestScaleOnlyFormatsOmitBias(t *testing.T) {
+	defer func(old bool) { *scaleOnly = old }(*scaleOnly)
+	*scaleOnly = true
+	ms := testMeasurements(8, 1)
+	r := fitStyle(ms, lookupStyle("diameter"), fitOptions{Anchor: &Measurement{Weight: 1}})
+	c := calibration{Result: r, Dpi: 10, Measurements: ms}
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "json" {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			var b strings.Builder
+			if err := formats[name](&b, c); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(strings.ToLower(b.String()), "bias") {
+				t.Errorf("-format %s wrote a bias under -scale-only:\n%s", name, b.String())
+			}
+		})
+	}
+}
+
+// Returns the error of the best fraction with a denominator up to maxDenom, by trying each.
+func bestRatioError(x float64, maxDenom int64) float64 {
+	best := math.Inf(1)
+	for d := int64(1); d <= maxDenom; d++ {
+		best = math.Min(best, math.Abs(math.Round(x*float64(d))/float64(d)-x))
+	}
+	return best
+}
+
+func TestApproximateRatio(t *testing.T) {
+	tests := []struct {
+		x          float64
+		maxDenom   int64
+		num, denom int64
+	}{
+		{0.5, 1000, 1, 2},
+		{-0.75, 1000, -3, 4},
+		{2, 1000, 2, 1},
+		{0, 1000, 0, 1},
+		{math.Pi, 1000, 355, 113},
+		{math.Pi, 100, 311, 99},
+		{12.652592, 1, 13, 1},
+		// Too large for the continued fraction, so rounded.
+		{1e12 + 0.3, 1000, 1e12, 1},
+	}
+	for _, test := range tests {
+		num, denom := approximateRatio(test.x, test.maxDenom)
+		if num != test.num || denom != test.denom {
+			t.Errorf("approximateRatio(%g, %d) = %d/%d, want %d/%d", test.x, test.maxDenom, num,
+				denom, test.num, test.denom)
+		}
+	}
+	// Whatever the value, no fraction within the denominator limit may be closer.
+	for _, x := range []float64{0.761745, 12.652592, 7.39598, -4.452727, 0.0001, 1.0 / 3} {
+		num, denom := approximateRatio(x, 1000)
+		got := math.Abs(float64(num)/float64(denom) - x)
+		if want := bestRatioError(x, 1000); denom > 1000 || got > want+1e-15 {
+			t.Errorf("approximateRatio(%g, 1000) = %d/%d, off by %g, but the best is off by %g",
+				x, num, denom, got, want)
+		}
+	}
+}
+
+func TestWriteFixed(t *testing.T) {
+	defer func(old int) { *fracBits = old }(*fracBits)
+	// A pixel scale of 20 and bias of -10.25, both exact in binary.
+	c := calibration{Result: OptimizationResult{Type: "diameter", Scale: 2, Bias: -1.025}, Dpi: 10}
+	tests := []struct {
+		bits int
+		want string
+		err  string
+	}{
+		{bits: 16, want: "# Q15.16 fixed point: values are integers / 2^16, from -32768 to " +
+			"32767.99998474121\n" +
+			"touch.size.frac_bits = 16\n" +
+			"touch.size.calibration = diameter\n" +
+			"# touch.size.scale = 20.000000, quantization error 0\n" +
+			"touch.size.scale = 1310720\n" +
+			"# touch.size.bias = -10.250000, quantization error 0\n" +
+			"touch.size.bias = -671744\n"},
+		{bits: 0, want: "# Q31.0 fixed point: values are integers / 2^0, from -2.147483648e+09 to " +
+			"2.147483647e+09\n" +
+			"touch.size.frac_bits = 0\n" +
+			"touch.size.calibration = diameter\n" +
+			"# touch.size.scale = 20.000000, quantization error 0\n" +
+			"touch.size.scale = 20\n" +
+			"# touch.size.bias = -10.250000, quantization error 0.25\n" +
+			"touch.size.bias = -10\n"},
+		{bits: 28, err: "touch.size.scale 20.000000 is outside the range of Q3.28"},
+		{bits: 32, err: "-frac-bits must be from 0 to 31"},
+		{bits: -1, err: "-frac-bits must be from 0 to 31"},
+	}
+	for _, test := range tests {
+		*fracBits = test.bits
+		var b strings.Builder
+		err := writeFixed(&b, c)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("-frac-bits %d: got error %v, want one containing %q", test.bits, err,
+					test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("-frac-bits %d: %v", test.bits, err)
+			continue
+		}
+		if b.String() != test.want {
+			t.Errorf("-frac-bits %d wrote\n%s\nwant\n%s", test.bits, b.String(), test.want)
+		}
+	}
+}
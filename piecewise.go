@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The fewest measurements allowed on either side of a searched breakpoint.
+const minSegmentPoints = 3
+
+// A fit of two lines, one to the measurements reported below Breakpoint and one to those above
+// it. The lines of findBreakpoint are independent; those of fitSegments meet at Breakpoint.
+type segmentFit struct {
+	Breakpoint float64
+	Low, High  OptimizationResult
+	// The root mean square error of both segments together.
+	Error float64
+}
+
+// Searches for the breakpoint that minimizes the combined error of fitting style separately to
+// the measurements on either side of it. Candidate breakpoints lie midway between consecutive
+// distinct reported values, leaving at least minSegmentPoints measurements on each side. Reports
+// false if there are too few measurements for any candidate.
+func findBreakpoint(ms []Measurement, style ReportingStyle, opts fitOptions) (segmentFit, bool) {
+	sorted := make([]Measurement, len(ms))
+	copy(sorted, ms)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Reported < sorted[j].Reported
+	})
+	best := segmentFit{Error: math.Inf(1)}
+	found := false
+	for i := minSegmentPoints; i <= len(sorted)-minSegmentPoints; i++ {
+		if sorted[i-1].Reported == sorted[i].Reported {
+			continue
+		}
+		low := fitStyle(sorted[:i], style, opts)
+		high := fitStyle(sorted[i:], style, opts)
+		sse := low.Error*low.Error*float64(i) + high.Error*high.Error*float64(len(sorted)-i)
+		stdError := math.Sqrt(sse / float64(len(sorted)))
+		if stdError < best.Error {
+			best = segmentFit{(sorted[i-1].Reported + sorted[i].Reported) / 2, low, high, stdError}
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Prints the two segment fit found by findBreakpoint alongside the single line fit r. Since an
+// idc can only express a single line this is purely diagnostic.
+func printBreakpointSearch(ms []Measurement, style ReportingStyle, r OptimizationResult,
+	opts fitOptions) {
+	fit, ok := findBreakpoint(ms, style, opts)
+	if !ok {
+		fmt.Printf("Too few measurements to search for a breakpoint, need at least %d\n",
+			2*minSegmentPoints)
+		return
+	}
+	fmt.Printf("Two segment fit of %s with breakpoint at reported=%f:\n", style.Type(), fit.Breakpoint)
+	fmt.Printf("  Below: %v\n", fit.Low)
+	fmt.Printf("  Above: %v\n", fit.High)
+	fmt.Printf("  Combined error=%f, single line error=%f\n", fit.Error, r.Error)
+}
+
+// Fits style to ms with a hinge: two lines, one for the measurements reported below breakpoint
+// and one for those above, constrained to meet at it so that the calibration curve is
+// continuous. In the style's transformed space, with xb the transformed breakpoint, u = min(x -
+// xb, 0) and v = max(x - xb, 0), this is the weighted least squares fit of y = b + s1*u + s2*v.
+// Since u*v is always 0 the normal equations give s1 = (Suy - Su*b)/Suu and s2 = (Svy - Sv*b)/Svv,
+// which substituted into the first leaves b in closed form. Each side needs a measurement reported
+// strictly beyond the breakpoint, and two on or beyond it, for its slope to be identified. The
+// segments' standard errors aren't estimated.
+func fitSegments(ms []Measurement, style ReportingStyle, breakpoint float64) (segmentFit, error) {
+	var below, above, atOrBelow, atOrAbove int
+	for _, m := range ms {
+		switch {
+		case m.Reported < breakpoint:
+			below++
+		case m.Reported > breakpoint:
+			above++
+		}
+		if m.Reported <= breakpoint {
+			atOrBelow++
+		}
+		if m.Reported >= breakpoint {
+			atOrAbove++
+		}
+	}
+	if below == 0 || above == 0 || atOrBelow < 2 || atOrAbove < 2 {
+		return segmentFit{}, fmt.Errorf("%w: need at least 2 measurements on each side of "+
+			"reported=%g, got %d below and %d above", ErrInsufficientData, breakpoint, atOrBelow,
+			atOrAbove)
+	}
+	xb := style.Apply(Measurement{Reported: breakpoint, Weight: 1}).Reported
+	var sw, su, sv, suu, svv, sy, suy, svy float64
+	for _, m := range ms {
+		t := style.Apply(m)
+		u, v := math.Min(t.Reported-xb, 0), math.Max(t.Reported-xb, 0)
+		sw += t.Weight
+		su += t.Weight * u
+		sv += t.Weight * v
+		suu += t.Weight * u * u
+		svv += t.Weight * v * v
+		sy += t.Weight * t.Physical
+		suy += t.Weight * u * t.Physical
+		svy += t.Weight * v * t.Physical
+	}
+	b := (sy - su*suy/suu - sv*svy/svv) / (sw - su*su/suu - sv*sv/svv)
+	s1, s2 := (suy-su*b)/suu, (svy-sv*b)/svv
+	fit := segmentFit{
+		Breakpoint: breakpoint,
+		Low:        OptimizationResult{style.Type(), s1, b - s1*xb, 0, math.NaN()},
+		High:       OptimizationResult{style.Type(), s2, b - s2*xb, 0, math.NaN()},
+	}
+	// The error of each segment is over the measurements on its side, and the combined error
+	// over all of them; a measurement at the breakpoint is predicted equally well by either.
+	var sseLow, sseHigh float64
+	for _, m := range ms {
+		if m.Reported <= breakpoint {
+			diff := m.Physical - Predict(style, fit.Low, m.Reported)
+			sseLow += diff * diff
+		} else {
+			diff := m.Physical - Predict(style, fit.High, m.Reported)
+			sseHigh += diff * diff
+		}
+	}
+	fit.Low.Error = math.Sqrt(sseLow / float64(atOrBelow))
+	fit.High.Error = math.Sqrt(sseHigh / float64(len(ms)-atOrBelow))
+	fit.Error = math.Sqrt((sseLow + sseHigh) / float64(len(ms)))
+	return fit, nil
+}
+
+// Prints the hinge fit of fitSegments alongside the single line fit r, with the physical size at
+// which its segments meet.
+func printSegments(fit segmentFit, style ReportingStyle, r OptimizationResult) {
+	fmt.Printf("Piecewise fit of %s hinged at reported=%g:\n", style.Type(), fit.Breakpoint)
+	fmt.Printf("  Below: %v\n", fit.Low)
+	fmt.Printf("  Above: %v\n", fit.High)
+	fmt.Printf("  The segments meet at physical=%f mm\n", Predict(style, fit.Low, fit.Breakpoint))
+	fmt.Printf("  Combined error=%f, single line error=%f\n", fit.Error, r.Error)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+const plistDoctype = `<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" ` +
+	`"http://www.apple.com/DTDs/PropertyList-1.0.dtd">`
+
+// A property list dictionary of string and real values, kept in order. Its XML form alternates
+// <key> elements with their values, which has no struct tag equivalent.
+type plistDict []plistEntry
+
+type plistEntry struct {
+	Key string
+	// The value's element name, "string" or "real", and its text.
+	Type, Value string
+}
+
+func (d plistDict) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, entry := range d {
+		key := xml.StartElement{Name: xml.Name{Local: "key"}}
+		if err := e.EncodeElement(entry.Key, key); err != nil {
+			return err
+		}
+		value := xml.StartElement{Name: xml.Name{Local: entry.Type}}
+		if err := e.EncodeElement(entry.Value, value); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+type plist struct {
+	XMLName xml.Name  `xml:"plist"`
+	Version string    `xml:"version,attr"`
+	Dict    plistDict `xml:"dict"`
+}
+
+// Writes the calibration as an XML property list dictionary, for macOS and iOS tooling. The
+// scale and bias are in pixels, as in an idc file.
+func writePlist(w io.Writer, c calibration) error {
+	dict := plistDict{
+		{"calibration", "string", c.Result.Type},
+		{"scale", "real", formatScale(c.Scale())},
+	}
+	if !*scaleOnly {
+		dict = append(dict, plistEntry{"bias", "real", formatBias(c.Bias())})
+	}
+	dict = append(dict, plistEntry{"dpi", "real", strconv.FormatFloat(c.Dpi, 'g', -1, 64)})
+	p := plist{Version: "1.0", Dict: dict}
+	if _, err := io.WriteString(w, xml.Header+plistDoctype+"\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
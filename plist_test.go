@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const plistGolden = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+	<dict>
+		<key>calibration</key>
+		<string>area</string>
+		<key>scale</key>
+		<real>30.000000</real>
+		<key>bias</key>
+		<real>-10.000000</real>
+		<key>dpi</key>
+		<real>10</real>
+	</dict>
+</plist>
+`
+
+func TestWritePlistGolden(t *testing.T) {
+	c := calibration{Result: OptimizationResult{Type: "area", Scale: 3, Bias: -1}, Dpi: 10}
+	var b strings.Builder
+	if err := writePlist(&b, c); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != plistGolden {
+		t.Errorf("writePlist wrote\n%s\nwant\n%s", got, plistGolden)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"plugin"
+	"strings"
+)
+
+// The name of the variable a -plugin must export. Since a plugin can't import package main, it
+// can't implement ReportingStyle, whose Apply takes a Measurement, directly. Instead Style must
+// implement PluginStyle using only built in types, for example:
+//
+//	package main
+//
+//	import "math"
+//
+//	type cubeRoot struct{}
+//
+//	func (cubeRoot) Transform(reported float64) float64 { return math.Cbrt(reported) }
+//	func (cubeRoot) Type() string                       { return "volume" }
+//	func (cubeRoot) Description() string                { return "reported size is a volume" }
+//
+//	var Style cubeRoot
+//
+// built with go build -buildmode=plugin against the same Go version as scali.
+const pluginSymbol = "Style"
+
+// The interface a plugin's exported Style implements: Transform maps a reported value into the
+// space where the physical size is linear in it, as ReportingStyle.Apply does.
+type PluginStyle interface {
+	Transform(reported float64) float64
+	Type() string
+	Description() string
+}
+
+// Adapts a PluginStyle to a ReportingStyle. Plugin styles are for analysis only, since an idc
+// only knows the built in calibrations.
+type pluginReporting struct {
+	PluginStyle
+}
+
+func (p pluginReporting) Apply(m Measurement) Measurement {
+	m.Reported = p.Transform(m.Reported)
+	return m
+}
+
+func (p pluginReporting) IdcCompatible() bool {
+	return false
+}
+
+// Opens the Go plugin at path and registers the style its Style variable implements.
+func loadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	sym, err := p.Lookup(pluginSymbol)
+	if err != nil {
+		return fmt.Errorf("%s: does not export a %s variable: %v", path, pluginSymbol, err)
+	}
+	style, ok := sym.(PluginStyle)
+	if !ok {
+		return fmt.Errorf("%s: %s is a %T, which doesn't implement Transform(float64) float64, "+
+			"Type() string and Description() string", path, pluginSymbol, sym)
+	}
+	if existing := lookupStyle(style.Type()); existing != nil {
+		return fmt.Errorf("%s: a style of type %q is already registered", path, style.Type())
+	}
+	RegisterStyle(pluginReporting{style})
+	return nil
+}
+
+// Loads each plugin in the comma separated list paths.
+func loadPlugins(paths string) error {
+	for _, path := range strings.Split(paths, ",") {
+		if err := loadPlugin(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
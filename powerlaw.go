@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Fits physical = a * reported^b by least squares on log(physical) against log(reported),
+// returning a, b and the standard error of the fit in log space. Every physical and reported
+// value must be positive.
+func findPowerLaw(ms []Measurement) (a, b, logError float64, err error) {
+	if len(ms) < 2 {
+		return 0, 0, 0, fmt.Errorf("%w: need at least 2 measurements, got %d",
+			ErrInsufficientData, len(ms))
+	}
+	logs := make([]Measurement, len(ms))
+	for i, m := range ms {
+		if m.Physical <= 0 || m.Reported <= 0 {
+			return 0, 0, 0, fmt.Errorf("%w: cannot take the log of the non-positive measurement on %s",
+				ErrInapplicableStyle, describeRow(m))
+		}
+		logs[i] = Measurement{Physical: math.Log(m.Physical), Reported: math.Log(m.Reported)}
+	}
+	b, logA := findScaleAndBias(logs)
+	if math.IsNaN(b) || math.IsInf(b, 0) {
+		return 0, 0, 0, fmt.Errorf("%w: the reported values don't determine a line in log space",
+			ErrDegenerateInput)
+	}
+	return math.Exp(logA), b, calculateError(logs, b, logA), nil
+}
+
+func printPowerLaw(a, b, logError float64) {
+	fmt.Printf("Power law: physical = %f * reported^%f\n", a, b)
+	fmt.Printf("Log-space error=%f (not comparable to the linear-space errors of the styles)\n",
+		logError)
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Returns the physical size in mm that the fit r of style predicts for a touch whose size is
+// reported as reported.
+func Predict(style ReportingStyle, r OptimizationResult, reported float64) float64 {
+	x := style.Apply(Measurement{Reported: reported, Weight: 1}).Reported
+	return r.Scale*x + r.Bias
+}
+
+func isFinite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
+
+// Returns the weight each result carries in an ensemble prediction, proportional to the inverse
+// of its error and normalized to sum to 1. Results that couldn't be fit get no weight, and if
+// any result fits perfectly those results share all of the weight. It is an error if no result
+// gets any weight, or an error so small that its inverse overflows.
+func ensembleWeights(results []OptimizationResult) ([]float64, error) {
+	weights := make([]float64, len(results))
+	perfect := 0
+	for _, r := range results {
+		if r.Error == 0 {
+			perfect++
+		}
+	}
+	sum := float64(0)
+	for i, r := range results {
+		switch {
+		case !isFinite(r.Error) || !isFinite(r.Scale) || !isFinite(r.Bias):
+			continue
+		case perfect > 0 && r.Error == 0:
+			weights[i] = 1
+		case perfect == 0:
+			weights[i] = 1 / r.Error
+		}
+		if !isFinite(weights[i]) {
+			return nil, fmt.Errorf("the %s error %g is too small to weight by its inverse", r.Type,
+				r.Error)
+		}
+		sum += weights[i]
+	}
+	if sum == 0 || !isFinite(sum) {
+		return nil, fmt.Errorf("no style could be fit to weight in the ensemble")
+	}
+	for i := range weights {
+		weights[i] /= sum
+	}
+	return weights, nil
+}
+
+// Returns the weighted average of each style's prediction for reported. Styles whose prediction
+// is NaN, such as the area style for a negative reported value, are left out and the remaining
+// weights renormalized.
+func PredictEnsemble(styles []ReportingStyle, results []OptimizationResult, weights []float64,
+	reported float64) float64 {
+	sum, sumWeight := float64(0), float64(0)
+	for i, style := range styles {
+		if weights[i] == 0 {
+			continue
+		}
+		p := Predict(style, results[i], reported)
+		if math.IsNaN(p) {
+			continue
+		}
+		sum += weights[i] * p
+		sumWeight += weights[i]
+	}
+	return sum / sumWeight
+}
+
+// Like printPredictions, but blends the predictions of every style by ensembleWeights, printing
+// the weights first.
+func printEnsemblePredictions(styles []ReportingStyle, results []OptimizationResult,
+	ms []Measurement, reported []float64) error {
+	weights, err := ensembleWeights(results)
+	if err != nil {
+		return err
+	}
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Style\tWeight")
+	for i, style := range styles {
+		fmt.Fprintf(tw, "%s\t%f\n", style.Type(), weights[i])
+	}
+	tw.Flush()
+	measured := reportedRange(ms)
+	tw = newTable(os.Stdout)
+	fmt.Fprintln(tw, "Reported\tPhysical")
+	extrapolated := 0
+	for _, x := range reported {
+		fmt.Fprintf(tw, "%f\t%f", x, PredictEnsemble(styles, results, weights, x))
+		if !measured.Contains(x) {
+			fmt.Fprint(tw, "\textrapolated")
+			extrapolated++
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	warnExtrapolated(extrapolated, measured)
+	return nil
+}
+
+func warnExtrapolated(extrapolated int, measured valueRange) {
+	if extrapolated > 0 {
+		warnf("%d predictions are outside the measured reported range %g to %g",
+			extrapolated, measured.Lo, measured.Hi)
+	}
+}
+
+// Returns the smallest range containing the reported values of ms.
+func reportedRange(ms []Measurement) valueRange {
+	r := valueRange{math.Inf(1), math.Inf(-1)}
+	for _, m := range ms {
+		r.Lo = math.Min(r.Lo, m.Reported)
+		r.Hi = math.Max(r.Hi, m.Reported)
+	}
+	return r
+}
+
+// Returns the range of physical sizes in ms.
+func physicalRange(ms []Measurement) valueRange {
+	r := valueRange{math.Inf(1), math.Inf(-1)}
+	for _, m := range ms {
+		r.Lo = math.Min(r.Lo, m.Physical)
+		r.Hi = math.Max(r.Hi, m.Physical)
+	}
+	return r
+}
+
+// Parses a -predict-range of the form min,max,n or min,max,n,spacing into the n reported values
+// from min to max inclusive, spaced evenly for linear spacing, the default, or by a constant
+// ratio for log spacing, which samples small contacts more finely.
+func parsePredictRange(s string) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	spacing := "linear"
+	if len(parts) == 4 {
+		spacing = parts[3]
+		parts = parts[:3]
+	}
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected min,max,n or min,max,n,log, got %q", s)
+	}
+	bounds, err := parseFloats(strings.Join(parts[:2], ","))
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := bounds[0], bounds[1]
+	n, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid number of points %q", parts[2])
+	}
+	if lo >= hi {
+		return nil, fmt.Errorf("min %g must be less than max %g", lo, hi)
+	}
+	if n < 2 {
+		return nil, fmt.Errorf("need at least 2 points, got %d", n)
+	}
+	vals := make([]float64, n)
+	switch spacing {
+	case "linear":
+		for i := range vals {
+			vals[i] = lo + (hi-lo)*float64(i)/float64(n-1)
+		}
+	case "log":
+		if lo <= 0 {
+			return nil, fmt.Errorf("log spacing needs a positive min, got %g", lo)
+		}
+		for i := range vals {
+			vals[i] = lo * math.Pow(hi/lo, float64(i)/float64(n-1))
+		}
+	default:
+		return nil, fmt.Errorf("unknown spacing %q, expected linear or log", spacing)
+	}
+	// Land exactly on max rather than wherever rounding puts the last point.
+	vals[n-1] = hi
+	return vals, nil
+}
+
+// Prints the physical size predicted for each reported value, flagging those outside the range
+// of reported values that were measured, where the prediction is an extrapolation.
+func printPredictions(style ReportingStyle, r OptimizationResult, ms []Measurement,
+	reported []float64) {
+	measured := reportedRange(ms)
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Reported\tPhysical")
+	extrapolated := 0
+	for _, x := range reported {
+		fmt.Fprintf(tw, "%f\t%f", x, Predict(style, r, x))
+		if !measured.Contains(x) {
+			fmt.Fprint(tw, "\textrapolated")
+			extrapolated++
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	warnExtrapolated(extrapolated, measured)
+}
+
+// Prints the widest prediction interval of the fit r of style over the range of reported values
+// in ms, a single worst-case accuracy figure for the calibration. The interval is narrowest at
+// the weighted mean of the transformed reported values and widens quadratically away from it, so
+// the widest is at one end of the range.
+func printWorstCaseAccuracy(style ReportingStyle, r OptimizationResult, ms []Measurement,
+	confidence float64) {
+	reported := reportedRange(ms)
+	worst, worstAt := float64(0), reported.Lo
+	for _, x := range []float64{reported.Lo, reported.Hi} {
+		if w := predictionHalfWidth(style, r, ms, x, confidence); w > worst {
+			worst, worstAt = w, x
+		}
+	}
+	physical := physicalRange(ms)
+	fmt.Printf("Calibrated to ±%f mm (%g%%) across the %g-%g mm range; "+
+		"the worst case is at reported=%g\n", worst, 100*confidence, physical.Lo, physical.Hi,
+		worstAt)
+}
+
+// Returns the largest quantization step in reported units that keeps the physical size the fit r
+// of style predicts at reported within accuracy mm. Rounding to the nearest step errs by up to
+// half of it, scaled by the slope of the calibration there, which is estimated by a difference
+// taken towards dir so it stays inside the measured range.
+func requiredResolution(style ReportingStyle, r OptimizationResult, reported, dir,
+	accuracy float64) float64 {
+	h := dir * 1e-6 * math.Max(1, math.Abs(reported))
+	slope := math.Abs((Predict(style, r, reported+h) - Predict(style, r, reported)) / h)
+	return 2 * accuracy / slope
+}
+
+// Prints the reported resolution the controller must provide for the fit r of style to be
+// accurate to accuracy mm, at both ends of the measured range since a nonlinear style's slope,
+// and with it the resolution needed, varies across it.
+func printRequiredResolution(style ReportingStyle, r OptimizationResult, ms []Measurement,
+	accuracy float64) {
+	reported := reportedRange(ms)
+	lo := requiredResolution(style, r, reported.Lo, 1, accuracy)
+	hi := requiredResolution(style, r, reported.Hi, -1, accuracy)
+	if math.Abs(lo-hi) <= 1e-6*math.Max(lo, hi) {
+		fmt.Printf("Reaching ±%g mm with the %s style needs a reported resolution of %.4g\n",
+			accuracy, style.Type(), math.Min(lo, hi))
+		return
+	}
+	fmt.Printf("Reaching ±%g mm with the %s style needs a reported resolution of %.4g at "+
+		"reported=%g and %.4g at reported=%g; the finer, %.4g, applies across the range\n", accuracy,
+		style.Type(), lo, reported.Lo, hi, reported.Hi, math.Min(lo, hi))
+}
+
+// The size in characters of the plotting area of an ascii -residual-plot.
+const (
+	residualPlotWidth  = 60
+	residualPlotHeight = 15
+)
+
+// Plots the residual of each measurement under the fit r of style against its reported value,
+// with a line at zero. A good fit scatters evenly about the line; a curve suggests the wrong style
+// and a fan that the noise grows with the contact size. The format is "ascii" for a character
+// plot, or "gnuplot" for a script like printParity's.
+func printResidualPlot(style ReportingStyle, r OptimizationResult, ms []Measurement,
+	format string) error {
+	ms = sortedByReported(ms)
+	res := residuals(style, r, ms)
+	switch format {
+	case "ascii":
+		reported := reportedRange(ms)
+		// Keep the zero line in the plot even if every residual has the same sign.
+		lo, hi := 0.0, 0.0
+		for _, d := range res {
+			lo, hi = math.Min(lo, d), math.Max(hi, d)
+		}
+		if hi == lo {
+			hi, lo = 1, -1
+		}
+		row := func(d float64) int {
+			return int(math.Round((hi - d) / (hi - lo) * (residualPlotHeight - 1)))
+		}
+		grid := make([][]byte, residualPlotHeight)
+		for i := range grid {
+			grid[i] = []byte(strings.Repeat(" ", residualPlotWidth))
+		}
+		zero := row(0)
+		for x := range grid[zero] {
+			grid[zero][x] = '-'
+		}
+		for i, m := range ms {
+			x := 0
+			if reported.Hi > reported.Lo {
+				x = int(math.Round((m.Reported - reported.Lo) / (reported.Hi - reported.Lo) *
+					(residualPlotWidth - 1)))
+			}
+			grid[row(res[i])][x] = '*'
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Residuals (mm) of the %s fit against reported\n", r.Type)
+		for i, line := range grid {
+			label := ""
+			switch i {
+			case 0:
+				label = fmt.Sprintf("%+.3f", hi)
+			case zero:
+				label = "0"
+			case residualPlotHeight - 1:
+				label = fmt.Sprintf("%+.3f", lo)
+			}
+			fmt.Fprintf(&b, "%8s |%s\n", label, strings.TrimRight(string(line), " "))
+		}
+		fmt.Fprintf(&b, "%8s +%s\n", "", strings.Repeat("-", residualPlotWidth))
+		fmt.Fprintf(&b, "%10s%-*g%g\n", "", residualPlotWidth-len(fmt.Sprint(reported.Hi)),
+			reported.Lo, reported.Hi)
+		_, err := io.WriteString(os.Stdout, b.String())
+		return err
+	case "gnuplot":
+		var b strings.Builder
+		fmt.Fprintf(&b, "# Residual plot generated by scali\n")
+		fmt.Fprintf(&b, "set title \"%s calibration residuals, RMS = %.4f mm\"\n", r.Type, r.Error)
+		fmt.Fprintf(&b, "set xlabel \"Reported size\"\n")
+		fmt.Fprintf(&b, "set ylabel \"Residual (mm)\"\n")
+		fmt.Fprintf(&b, "set key left top\n")
+		fmt.Fprintf(&b, "$residuals << EOD\n")
+		for i, m := range ms {
+			fmt.Fprintf(&b, "%f %f\n", m.Reported, res[i])
+		}
+		fmt.Fprintf(&b, "EOD\n")
+		fmt.Fprintf(&b, "plot $residuals using 1:2 with points title \"measurements\", "+
+			"0 with lines title \"zero\"\n")
+		_, err := io.WriteString(os.Stdout, b.String())
+		return err
+	default:
+		return fmt.Errorf("unknown format %q, expected ascii or gnuplot", format)
+	}
+}
+
+// Prints the physical size the fit r of style predicts at each of the reported values, fixed
+// points that let calibrations of devices with different scale and bias conventions be compared
+// directly. Unlike -predict, the points are usually outside the measured range, so extrapolation
+// isn't flagged.
+func printReferencePredictions(style ReportingStyle, r OptimizationResult, reported []float64) {
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Reported\tPhysical (mm)")
+	for _, x := range reported {
+		fmt.Fprintf(tw, "%g\t%f\n", x, Predict(style, r, x))
+	}
+	tw.Flush()
+}
+
+// Predicts the physical size of each measurement in truth, a held-out set that wasn't fit, with
+// the fit r of style and prints the error of each prediction along with their aggregate, an
+// out-of-sample check of the calibration.
+func printValidation(style ReportingStyle, r OptimizationResult, truth []Measurement) {
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Reported\tTruth\tPredicted\tError")
+	res := residuals(style, r, truth)
+	sse, sae, maxErr := float64(0), float64(0), float64(0)
+	for i, m := range truth {
+		fmt.Fprintf(tw, "%f\t%f\t%f\t%f\n", m.Reported, m.Physical, m.Physical-res[i], -res[i])
+		sse += res[i] * res[i]
+		sae += math.Abs(res[i])
+		maxErr = math.Max(maxErr, math.Abs(res[i]))
+	}
+	tw.Flush()
+	n := float64(len(truth))
+	fmt.Printf("Out-of-sample RMS error=%f, MAE=%f, max error=%f over %d points (fit error=%f)\n",
+		math.Sqrt(sse/n), sae/n, maxErr, len(truth), r.Error)
+}
+
+// Prints the predicted and measured physical size of each measurement under the fit r of style,
+// the coordinates of a parity chart where a perfect calibration lies on y = x. The format is
+// "table", or "gnuplot" for a script that plots them against the identity line.
+func printParity(style ReportingStyle, r OptimizationResult, ms []Measurement, format string) error {
+	ms = sortedByReported(ms)
+	res := residuals(style, r, ms)
+	r2 := computeStats(style, r, ms).R2
+	switch format {
+	case "table":
+		tw := newTable(os.Stdout)
+		fmt.Fprintln(tw, "Predicted\tMeasured")
+		for i, m := range ms {
+			fmt.Fprintf(tw, "%f\t%f\n", m.Physical-res[i], m.Physical)
+		}
+		tw.Flush()
+		fmt.Printf("R²=%f\n", r2)
+	case "gnuplot":
+		var b strings.Builder
+		fmt.Fprintf(&b, "# Parity plot generated by scali\n")
+		fmt.Fprintf(&b, "set title \"%s calibration, R² = %.4f\"\n", r.Type, r2)
+		fmt.Fprintf(&b, "set xlabel \"Predicted physical size (mm)\"\n")
+		fmt.Fprintf(&b, "set ylabel \"Measured physical size (mm)\"\n")
+		fmt.Fprintf(&b, "set size ratio -1\n")
+		fmt.Fprintf(&b, "set key left top\n")
+		fmt.Fprintf(&b, "$parity << EOD\n")
+		for i, m := range ms {
+			fmt.Fprintf(&b, "%f %f\n", m.Physical-res[i], m.Physical)
+		}
+		fmt.Fprintf(&b, "EOD\n")
+		fmt.Fprintf(&b, "plot $parity using 1:2 with points title \"measurements\", "+
+			"x with lines title \"y = x\"\n")
+		_, err := io.WriteString(os.Stdout, b.String())
+		return err
+	default:
+		return fmt.Errorf("unknown format %q, expected table or gnuplot", format)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEnsembleWeights(t *testing.T) {
+	nan := math.NaN()
+	fit := func(err float64) OptimizationResult {
+		return OptimizationResult{Type: "diameter", Scale: 1, Bias: 0, Error: err}
+	}
+	tests := []struct {
+		name    string
+		results []OptimizationResult
+		want    []float64
+		wantErr bool
+	}{
+		{"inverse error", []OptimizationResult{fit(1), fit(3)}, []float64{0.75, 0.25}, false},
+		{"perfect shares", []OptimizationResult{fit(0), fit(1), fit(0)}, []float64{0.5, 0, 0.5},
+			false},
+		{"unfit skipped", []OptimizationResult{fit(nan), fit(2)}, []float64{0, 1}, false},
+		{"infinite scale skipped", []OptimizationResult{{Scale: math.Inf(1), Error: 1}, fit(2)},
+			[]float64{0, 1}, false},
+		{"none fit", []OptimizationResult{fit(nan), fit(math.Inf(1))}, nil, true},
+		{"inverse overflows", []OptimizationResult{fit(1e-320), fit(1)}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ensembleWeights(test.results)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got weights %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range test.want {
+				if math.Abs(got[i]-test.want[i]) > testTolerance {
+					t.Errorf("weights %v, want %v", got, test.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The first line of a registry file, which describes its format.
+const registryHeader = "# scali calibration registry: model style scale bias rms, with the scale and bias " +
+	"in pixels and the rms error in mm"
+
+// Adds or replaces the entry for model in the registry file at path, a calibration database
+// collecting the results of many runs. Each line of the file is a whitespace separated entry:
+//
+//	model style scale bias rms
+//
+// Lines starting with '#' are comments. Other models' entries are kept as they are, in order, and
+// a new model is appended. Concurrent updates are serialized with a lock on path+".lock", and the
+// file is replaced atomically, so a run that dies halfway can't leave it truncated.
+func updateRegistry(path, model string, c calibration) error {
+	if model == "" || strings.ContainsAny(model, " \t#") {
+		return fmt.Errorf("model %q must be non-empty without whitespace or '#'", model)
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	entry := fmt.Sprintf("%s %s %s %s %f", model, c.Result.Type, formatScale(c.Scale()),
+		formatBias(c.Bias()), c.Result.Error)
+	var lines []string
+	if text := strings.TrimSuffix(string(data), "\n"); text != "" {
+		lines = strings.Split(text, "\n")
+	} else {
+		lines = []string{registryHeader}
+	}
+	found := false
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == model {
+			lines[i] = entry
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, entry)
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
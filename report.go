@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Writes the report of writeFitReport to path, or to stdout if path is empty.
+func emitFitReport(path string, ms []Measurement, results []OptimizationResult,
+	best OptimizationResult, opts fitOptions, dpi float64) error {
+	if path == "" {
+		return writeFitReport(os.Stdout, ms, results, best, opts, dpi)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = writeFitReport(f, ms, results, best, opts, dpi)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Writes a plain text report of the whole fit, suitable for attaching to a calibration ticket:
+// a summary of the measurements, the fit of every style, the winning equation with confidence
+// intervals for its coefficients, its residuals and any warnings about the data.
+func writeFitReport(w io.Writer, ms []Measurement, results []OptimizationResult,
+	best OptimizationResult, opts fitOptions, dpi float64) error {
+	var b strings.Builder
+	style := lookupStyle(best.Type)
+	stats := computeStats(style, best, ms)
+	physical, reported := physicalRange(ms), reportedRange(ms)
+
+	fmt.Fprintf(&b, "Touch size calibration report\n\n")
+	if *emitMeta {
+		writeMeta(&b, "  ")
+		fmt.Fprintln(&b)
+	}
+	fmt.Fprintf(&b, "Measurements\n")
+	tw := newTable(&b)
+	fmt.Fprintf(tw, "  Count\t%d\n", len(ms))
+	fmt.Fprintf(tw, "  Physical\t%g to %g mm\n", physical.Lo, physical.Hi)
+	fmt.Fprintf(tw, "  Reported\t%g to %g\n", reported.Lo, reported.Hi)
+	fmt.Fprintf(tw, "  Weighted\t%t\n", isWeighted(ms))
+	tw.Flush()
+
+	fmt.Fprintf(&b, "\nStyles\n")
+	tw = newTable(&b)
+	fmt.Fprintln(tw, "  Style\tScale\tBias\tError\tR²")
+	for _, r := range results {
+		fmt.Fprintf(tw, "  %s\t%f\t%f\t%f\t%f\n", r.Type, r.Scale, r.Bias, r.Error,
+			computeStats(lookupStyle(r.Type), r, ms).R2)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(&b, "\nBest fit\n")
+	fmt.Fprintf(&b, "  physical = %f * %s(reported) + %f\n", best.Scale, best.Type, best.Bias)
+	// The confidence intervals, like the significance test, assume a least squares fit.
+	if len(ms) > 2 && leastSquaresFit(opts) {
+		t := studentTCritical(significanceLevel, float64(len(ms)-2))
+		level := 100 * (1 - significanceLevel)
+		fmt.Fprintf(&b, "  scale %f, %g%% confidence interval %f to %f\n", best.Scale, level,
+			best.Scale-t*stats.ScaleStdErr, best.Scale+t*stats.ScaleStdErr)
+		fmt.Fprintf(&b, "  bias %f mm, %g%% confidence interval %f to %f\n", best.Bias, level,
+			best.Bias-t*stats.BiasStdErr, best.Bias+t*stats.BiasStdErr)
+	}
+	fmt.Fprintf(&b, "  RMS %f mm, MAE %f mm, max error %f mm, R² %f\n", stats.RMS, stats.MAE,
+		stats.MaxError, stats.R2)
+	c := calibration{best, dpi, ms, nil, fitOptions{}}
+	fmt.Fprintf(&b, "  at %g dots per mm: scale %s, bias %s\n", dpi, formatScale(c.Scale()),
+		formatBias(c.Bias()))
+
+	fmt.Fprintf(&b, "\nResiduals\n")
+	tw = newTable(&b)
+	fmt.Fprintln(tw, "  Line\tPhysical\tReported\tPredicted\tResidual")
+	for i, m := range ms {
+		fmt.Fprintf(tw, "  %d\t%f\t%f\t%f\t%f\n", m.Line, m.Physical, m.Reported,
+			m.Physical-stats.Residuals[i], stats.Residuals[i])
+	}
+	tw.Flush()
+
+	fmt.Fprintf(&b, "\nWarnings\n")
+	warnings := reportWarnings(ms, best, opts)
+	if len(warnings) == 0 {
+		fmt.Fprintf(&b, "  none\n")
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(&b, "  %s\n", warning)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Returns the problems with the measurements and the fit best that the data checks would warn
+// about, whether or not those checks were enabled. The significance of the scale is only tested
+// for the least squares fits it applies to.
+func reportWarnings(ms []Measurement, best OptimizationResult, opts fitOptions) []string {
+	var warnings []string
+	if problem := checkPhysicalRange(ms); problem != "" {
+		warnings = append(warnings, problem)
+	}
+	warnings = append(warnings, checkMonotonic(ms)...)
+	if len(ms) <= 2 {
+		warnings = append(warnings, "at least 3 measurements are needed to test whether the fit "+
+			"is significant")
+	} else if leastSquaresFit(opts) && !IsSignificant(best, len(ms), significanceLevel) {
+		warnings = append(warnings, fmt.Sprintf("fitted scale is not significantly different "+
+			"from zero (p=%.3g)", slopePValue(best, len(ms))))
+	}
+	return warnings
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// Estimates y = bias + scale * x, where x = Reported and y = Physical, using the Theil-Sen
+// estimator: the scale is the median of the slopes between every pair of measurements with
+// distinct reported values, and the bias is the median of the residual intercepts. Unlike ordinary
+// least squares, a few bad measurements can't drag the line arbitrarily far.
+func findTheilSen(ms []Measurement) (float64, float64) {
+	var slopes []float64
+	for i := range ms {
+		for j := i + 1; j < len(ms); j++ {
+			dx := ms[j].Reported - ms[i].Reported
+			if dx == 0 {
+				continue
+			}
+			slopes = append(slopes, (ms[j].Physical-ms[i].Physical)/dx)
+		}
+	}
+	scale := median(slopes)
+	intercepts := make([]float64, len(ms))
+	for i, m := range ms {
+		intercepts[i] = m.Physical - scale*m.Reported
+	}
+	return scale, median(intercepts)
+}
+
+// Returns the median of nums without modifying it, or NaN if nums is empty.
+func median(nums []float64) float64 {
+	if len(nums) == 0 {
+		return math.NaN()
+	}
+	sorted := make([]float64, len(nums))
+	copy(sorted, nums)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Prints the ordinary least squares and Theil-Sen fits of style to ms side by side with their
+// differences. A large gap means a few outliers are pulling the least squares line.
+func printContrast(ms []Measurement, style ReportingStyle) {
+	ols := fits.Fit(ms, style, fitOptions{})
+	ts := fits.Fit(ms, style, fitOptions{TheilSen: true})
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Fit\tScale\tBias\tError")
+	fmt.Fprintf(tw, "OLS\t%f\t%f\t%f\n", ols.Scale, ols.Bias, ols.Error)
+	fmt.Fprintf(tw, "Theil-Sen\t%f\t%f\t%f\n", ts.Scale, ts.Bias, ts.Error)
+	fmt.Fprintf(tw, "Difference\t%+f\t%+f\t%+f\n", ts.Scale-ols.Scale, ts.Bias-ols.Bias,
+		ts.Error-ols.Error)
+	tw.Flush()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+)
+
+// The body of a request to the /fit endpoint. Measurements are objects with "physical" and
+// "reported" fields, and an optional "weight". The dpi defaults to -dpi, and -reported-offset is
+// subtracted from the reported values as it is from those read from a file.
+type fitRequest struct {
+	Dpi          *float64         `json:"dpi"`
+	Measurements []fitMeasurement `json:"measurements"`
+}
+
+type fitMeasurement struct {
+	Physical float64  `json:"physical"`
+	Reported float64  `json:"reported"`
+	Weight   *float64 `json:"weight"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Serves calibrations over HTTP on addr. POSTing a fitRequest to /fit fits styles to its
+// measurements and responds with the best calibration in the same structure as the json format.
+func serve(addr string, styles []ReportingStyle, opts fitOptions) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fit", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeHTTPError(w, http.StatusMethodNotAllowed, fmt.Errorf("/fit only accepts POST"))
+			return
+		}
+		var fr fitRequest
+		if err := json.NewDecoder(req.Body).Decode(&fr); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+			return
+		}
+		dpi := *dpiFlag
+		if fr.Dpi != nil {
+			dpi = *fr.Dpi
+		}
+		ms := make([]Measurement, len(fr.Measurements))
+		negative := 0
+		for i, fm := range fr.Measurements {
+			ms[i] = Measurement{Physical: fm.Physical, Reported: fm.Reported - *reportedOffset,
+				Weight: 1}
+			if fm.Weight != nil {
+				// A zero weight would drop the measurement, like a zero uncertainty in the input
+				// would give it an infinite weight.
+				if !(*fm.Weight > 0) || math.IsInf(*fm.Weight, 0) {
+					writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("measurement %d: weight "+
+						"must be positive, got %g", i+1, *fm.Weight))
+					return
+				}
+				ms[i].Weight = *fm.Weight
+			}
+			if *reportedOffset != 0 && ms[i].Reported < 0 {
+				negative++
+			}
+		}
+		warnNegativeReported(negative)
+		if len(ms) == 0 {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("no measurements in request"))
+			return
+		}
+		results := fitStyles(ms, styles, opts)
+		best := findBestResult(results)
+		if math.IsNaN(best.Error) {
+			_, err := Fit(ms, lookupStyle(best.Type), opts)
+			if err == nil {
+				err = fmt.Errorf("no style could be fit to the measurements")
+			}
+			writeHTTPError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := writeJSON(w, calibration{best, dpi, ms, results, opts}); err != nil {
+			log.Printf("writing /fit response: %v", err)
+		}
+	})
+	log.Printf("serving calibrations on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encodeJSON(w, errorResponse{err.Error()})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Everything known about how well a fit describes its measurements. Errors are in mm.
+type Stats struct {
+	Scale, Bias float64
+	// The root mean square, mean absolute and largest absolute residual.
+	RMS, MAE, MaxError float64
+	// The coefficient of determination of the physical sizes.
+	R2 float64
+	// The standard errors of the scale and bias; NaN with fewer than 3 measurements.
+	ScaleStdErr, BiasStdErr float64
+	N                       int
+	// The measured minus predicted physical size of each measurement, in input order.
+	Residuals []float64
+}
+
+// Fits style to ms as Fit does with the default options and returns the statistics of the fit.
+func FitStats(ms []Measurement, style ReportingStyle) (Stats, error) {
+	r, err := Fit(ms, style, fitOptions{})
+	if err != nil {
+		return Stats{}, err
+	}
+	return computeStats(style, r, ms), nil
+}
+
+// Returns how well the given scale and bias of style, such as hand tuned or vendor supplied ones,
+// fit ms without fitting anything: the RMS error in mm and R².
+func Evaluate(ms []Measurement, style ReportingStyle, scale, bias float64) (rms, r2 float64,
+	err error) {
+	if len(ms) == 0 {
+		return 0, 0, fmt.Errorf("%s: %w: no measurements to evaluate against", style.Type(),
+			ErrInsufficientData)
+	}
+	for _, m := range ms {
+		if x := style.Apply(m).Reported; math.IsNaN(x) || math.IsInf(x, 0) {
+			return 0, 0, fmt.Errorf("%s: %w: cannot transform reported value %g",
+				style.Type(), ErrInapplicableStyle, m.Reported)
+		}
+	}
+	r := OptimizationResult{Type: style.Type(), Scale: scale, Bias: bias}
+	stats := computeStats(style, r, ms)
+	return stats.RMS, stats.R2, nil
+}
+
+// Returns the statistics of the fit r of style to ms.
+func computeStats(style ReportingStyle, r OptimizationResult, ms []Measurement) Stats {
+	res := residuals(style, r, ms)
+	physical := make([]float64, len(ms))
+	sse, sae, maxErr := float64(0), float64(0), float64(0)
+	for i, d := range res {
+		physical[i] = ms[i].Physical
+		sse += d * d
+		sae += math.Abs(d)
+		maxErr = math.Max(maxErr, math.Abs(d))
+	}
+	avg := average(physical)
+	sst := float64(0)
+	for _, p := range physical {
+		sst += (p - avg) * (p - avg)
+	}
+	cov := covariance(style, r, ms)
+	n := float64(len(ms))
+	return Stats{
+		Scale:       r.Scale,
+		Bias:        r.Bias,
+		RMS:         math.Sqrt(sse / n),
+		MAE:         sae / n,
+		MaxError:    maxErr,
+		R2:          1 - sse/sst,
+		ScaleStdErr: math.Sqrt(cov[0][0]),
+		BiasStdErr:  math.Sqrt(cov[1][1]),
+		N:           len(ms),
+		Residuals:   res,
+	}
+}
+
+// Returns the standard error of the fitted scale: sqrt(sse / (n - 2) / sxx), where sse is the
+// weighted sum of squared residuals and sxx is the weighted sum of squared deviations of the
+// reported values from their mean. Returns NaN if there are too few measurements to estimate it.
+func scaleStdErr(ms []Measurement, scale, bias float64) float64 {
+	n := float64(len(ms))
+	if n <= 2 {
+		return math.NaN()
+	}
+	avgReport, _ := weightedMeans(ms)
+	sse, sxx := float64(0), float64(0)
+	for _, m := range ms {
+		diff := m.Physical - (m.Reported*scale + bias)
+		sse += m.Weight * diff * diff
+		dev := m.Reported - avgReport
+		sxx += m.Weight * dev * dev
+	}
+	return math.Sqrt(sse / (n - 2) / sxx)
+}
+
+// Returns the covariance matrix of the fitted (scale, bias) of r for style: sse / (n - 2) times
+// the inverse of XᵀWX, where each row of X is (transformed reported value, 1) and W holds the
+// weights. Row and column 0 are the scale and 1 is the bias, both in mm. The entries are NaN if
+// there are too few measurements to estimate them. Like scaleStdErr, this assumes a least squares
+// fit, so it understates the uncertainty of anchored or Theil-Sen fits.
+func covariance(style ReportingStyle, r OptimizationResult, ms []Measurement) [2][2]float64 {
+	nan := math.NaN()
+	if len(ms) <= 2 {
+		return [2][2]float64{{nan, nan}, {nan, nan}}
+	}
+	sw, sx, sxx, sse := float64(0), float64(0), float64(0), float64(0)
+	for _, m := range ms {
+		m = style.Apply(m)
+		sw += m.Weight
+		sx += m.Weight * m.Reported
+		sxx += m.Weight * m.Reported * m.Reported
+		diff := m.Physical - (m.Reported*r.Scale + r.Bias)
+		sse += m.Weight * diff * diff
+	}
+	k := sse / float64(len(ms)-2) / (sxx*sw - sx*sx)
+	return [2][2]float64{{k * sw, -k * sx}, {-k * sx, k * sxx}}
+}
+
+// Returns the half-width in mm of the prediction interval at the given confidence level for a new
+// measurement reported as reported under the fit r of style to ms: the critical t value times
+// the standard deviation of a new observation about the fitted line, sqrt(s² + xᵀ C x), where s²
+// is the residual variance, C the covariance of the coefficients and x = (transformed reported
+// value, 1).
+func predictionHalfWidth(style ReportingStyle, r OptimizationResult, ms []Measurement,
+	reported, confidence float64) float64 {
+	n := len(ms)
+	if n <= 2 {
+		return math.NaN()
+	}
+	sse := float64(0)
+	for _, m := range ms {
+		m = style.Apply(m)
+		diff := m.Physical - (m.Reported*r.Scale + r.Bias)
+		sse += m.Weight * diff * diff
+	}
+	cov := covariance(style, r, ms)
+	x := style.Apply(Measurement{Reported: reported, Weight: 1}).Reported
+	variance := sse/float64(n-2) + x*x*cov[0][0] + 2*x*cov[0][1] + cov[1][1]
+	return studentTCritical(1-confidence, float64(n-2)) * math.Sqrt(variance)
+}
+
+// Returns the residual, measured minus predicted physical size in mm, of each measurement under
+// the fit r of style.
+func residuals(style ReportingStyle, r OptimizationResult, ms []Measurement) []float64 {
+	res := make([]float64, len(ms))
+	for i, m := range ms {
+		res[i] = m.Physical - Predict(style, r, m.Reported)
+	}
+	return res
+}
+
+// Returns the two-sided p-value of the t-test that the fitted scale of r is zero, based on
+// n measurements and so n - 2 degrees of freedom. Returns NaN if n <= 2.
+func slopePValue(r OptimizationResult, n int) float64 {
+	if n <= 2 || math.IsNaN(r.ScaleStdErr) {
+		return math.NaN()
+	}
+	if r.ScaleStdErr == 0 {
+		return 0
+	}
+	t := r.Scale / r.ScaleStdErr
+	return studentTTwoSided(t, float64(n-2))
+}
+
+// Reports whether opts give a least squares fit, weighted or not, whose standard errors
+// scaleStdErr and covariance estimate. Anchored, Theil-Sen and prior fits aren't, so the
+// significance of their scale can't be tested from those.
+func leastSquaresFit(opts fitOptions) bool {
+	return opts.Anchor == nil && !opts.TheilSen && opts.PriorWeight == 0
+}
+
+// Reports whether the fitted scale of r is significantly different from zero at level alpha,
+// i.e. whether the measurements actually constrain the calibration. The fit must have used more
+// than two measurements.
+func IsSignificant(r OptimizationResult, n int, alpha float64) bool {
+	p := slopePValue(r, n)
+	return !math.IsNaN(p) && p < alpha
+}
+
+// Returns the t > 0 with P(|T| >= t) = alpha for a Student's t distribution with df degrees of
+// freedom, the critical value of a two-sided test or confidence interval at level alpha. It is
+// found by bisection, since studentTTwoSided decreases monotonically in t.
+func studentTCritical(alpha, df float64) float64 {
+	lo, hi := float64(0), float64(1)
+	for studentTTwoSided(hi, df) > alpha {
+		hi *= 2
+	}
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if studentTTwoSided(mid, df) > alpha {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// Returns P(|T| >= |t|) for a Student's t distribution with df degrees of freedom.
+func studentTTwoSided(t, df float64) float64 {
+	return regIncBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// Returns the regularized incomplete beta function I_x(a, b), evaluated with the continued
+// fraction from Numerical Recipes, which converges quickly for x < (a + 1) / (a + b + 2) and is
+// otherwise applied to the symmetric I_{1-x}(b, a).
+func regIncBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	c, d := float64(1), 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		// Even step of the recurrence.
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		// Odd step of the recurrence.
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
+
+// The rules -compare-all-metrics picks a winner under, in the order they are reported.
+var selectionRules = []string{"rms", "mae", "max", "aic", "cv"}
+
+// Returns the type of the style among results, fit to ms with opts, that wins under each of the
+// selectionRules, keyed by rule. Every style has the same number of parameters, so AIC always
+// ranks them as RMS does; it is there so that reviewers needn't take that on trust.
+// Cross-validation needs at least 3 measurements and is omitted with fewer.
+func selectionWinners(results []OptimizationResult, ms []Measurement,
+	opts fitOptions) map[string]string {
+	// The number of fitted parameters, for AIC.
+	k := 2.0
+	if opts.Anchor != nil {
+		k = 1
+	}
+	n := float64(len(ms))
+	rules := map[string]func(r OptimizationResult) float64{
+		"rms": func(r OptimizationResult) float64 { return resultMetrics["rms"](r, ms) },
+		"mae": func(r OptimizationResult) float64 { return resultMetrics["mae"](r, ms) },
+		"max": func(r OptimizationResult) float64 { return resultMetrics["max"](r, ms) },
+		"aic": func(r OptimizationResult) float64 {
+			return n*math.Log(r.Error*r.Error) + 2*k
+		},
+		"cv": func(r OptimizationResult) float64 {
+			cv, err := crossValidationError(ms, lookupStyle(r.Type), opts)
+			if err != nil {
+				return math.NaN()
+			}
+			return cv
+		},
+	}
+	winners := make(map[string]string)
+	for _, rule := range selectionRules {
+		if rule == "cv" && len(ms) < 3 {
+			continue
+		}
+		best, bestValue := "", math.NaN()
+		for _, r := range results {
+			if math.IsNaN(r.Error) {
+				continue
+			}
+			if v := rules[rule](r); !math.IsNaN(v) && (best == "" || v < bestValue) {
+				best, bestValue = r.Type, v
+			}
+		}
+		if best != "" {
+			winners[rule] = best
+		}
+	}
+	return winners
+}
+
+// Reports whether every rule in winners picked the same style.
+func unanimous(winners map[string]string) bool {
+	first := ""
+	for _, t := range winners {
+		if first == "" {
+			first = t
+		} else if t != first {
+			return false
+		}
+	}
+	return true
+}
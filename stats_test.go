@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	// physical = 2 * reported + 1 exactly.
+	ms := []Measurement{
+		{Physical: 3, Reported: 1, Weight: 1},
+		{Physical: 5, Reported: 2, Weight: 1},
+		{Physical: 7, Reported: 3, Weight: 1},
+		{Physical: 9, Reported: 4, Weight: 1},
+	}
+	diameter := lookupStyle("diameter")
+
+	rms, r2, err := Evaluate(ms, diameter, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rms > 1e-12 || math.Abs(r2-1) > 1e-12 {
+		t.Errorf("known good parameters: rms %g, R² %g, want 0 and 1", rms, r2)
+	}
+
+	// Off by 1 mm everywhere: the RMS error is 1 and R², 1 - 4/20, drops below 1.
+	rms, r2, err = Evaluate(ms, diameter, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(rms-1) > 1e-12 || math.Abs(r2-0.8) > 1e-12 {
+		t.Errorf("parameters 1 mm off: rms %g, R² %g, want 1 and 0.8", rms, r2)
+	}
+
+	// A wrong sign predicts worse than the mean, so R² goes negative.
+	rms, r2, err = Evaluate(ms, diameter, -2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rms < 5 || r2 >= 0 {
+		t.Errorf("known bad parameters: rms %g, R² %g, want a large error and negative R²", rms, r2)
+	}
+
+	if _, _, err := Evaluate(nil, diameter, 2, 1); !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("no measurements: got error %v, want ErrInsufficientData", err)
+	}
+	negative := []Measurement{{Physical: 1, Reported: -4, Weight: 1}}
+	if _, _, err := Evaluate(negative, lookupStyle("area"), 1, 0); !errors.Is(err,
+		ErrInapplicableStyle) {
+		t.Errorf("negative reported value for area: got error %v, want ErrInapplicableStyle", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+)
+
+// Accumulates the sums needed for an ordinary least squares fit of Physical against Reported, so
+// that the fit can be updated one measurement at a time without retaining the measurements.
+type accumulator struct {
+	n, sumX, sumY, sumXX, sumYY, sumXY float64
+}
+
+func (a *accumulator) Add(m Measurement) {
+	a.n++
+	a.sumX += m.Reported
+	a.sumY += m.Physical
+	a.sumXX += m.Reported * m.Reported
+	a.sumYY += m.Physical * m.Physical
+	a.sumXY += m.Reported * m.Physical
+}
+
+// Returns the least squares fit of the measurements added so far as a result of the given type.
+func (a *accumulator) Fit(styleType string) OptimizationResult {
+	sxx := a.sumXX - a.sumX*a.sumX/a.n
+	scale := (a.sumXY - a.sumX*a.sumY/a.n) / sxx
+	bias := (a.sumY - scale*a.sumX) / a.n
+	// Expand sum((y - bias - scale*x)^2) in terms of the accumulated sums.
+	sse := a.sumYY + a.n*bias*bias + scale*scale*a.sumXX -
+		2*bias*a.sumY - 2*scale*a.sumXY + 2*scale*bias*a.sumX
+	sse = math.Max(sse, 0)
+	stdErr := math.NaN()
+	if a.n > 2 {
+		stdErr = math.Sqrt(sse / (a.n - 2) / sxx)
+	}
+	return OptimizationResult{styleType, scale, bias, math.Sqrt(sse / a.n), stdErr}
+}
+
+// The flags that prepare or weight the measurements as a whole before fitting, which followFit
+// can't honor since it only keeps running sums.
+var followUnsupportedFlags = []string{
+	"weight-scheme", "golden-weight", "section-weights", "sections", "trim-range",
+	"zero-reference", "reported-resolution", "average-replicates", "smooth",
+	"collapse-duplicates", "check-monotonic", "abs-range",
+}
+
+// Reads measurements from r until EOF, refitting every style as they arrive and printing the
+// current best fit after every `every` new measurements. The final fit is printed once r is
+// exhausted.
+func followFit(r io.Reader, opts parseOptions, styles []ReportingStyle, every int, dpi float64) error {
+	accs := make([]accumulator, len(styles))
+	results := func() []OptimizationResult {
+		results := make([]OptimizationResult, len(styles))
+		for i, style := range styles {
+			results[i] = accs[i].Fit(style.Type())
+		}
+		return results
+	}
+	count := 0
+	stats, err := scanMeasurements(r, opts, func(m Measurement) error {
+		if m.Weight != 1 {
+			return fmt.Errorf("measurement uncertainties are not supported with -follow")
+		}
+		for i, style := range styles {
+			accs[i].Add(style.Apply(m))
+		}
+		count++
+		if count%every == 0 {
+			infof("After %d measurements: %v", count, findBestResult(results()))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("no measurements found in input")
+	}
+	warnNegativeReported(stats.NegativeReported)
+	best := findBestResult(results())
+	infof("%v", best)
+	return writeText(os.Stdout, calibration{best, dpi, nil, nil, fitOptions{}})
+}
+
+// Prints how the least squares fit of style evolves as the measurements are added one at a time,
+// in input order, starting from the first two. Once the scale and bias stop moving, collecting
+// more measurements is unlikely to change the calibration.
+func printLearningCurve(ms []Measurement, style ReportingStyle) {
+	var acc accumulator
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Points\tScale\tBias\tError")
+	for i, m := range ms {
+		acc.Add(style.Apply(m))
+		if i == 0 {
+			continue
+		}
+		r := acc.Fit(style.Type())
+		fmt.Fprintf(tw, "%d\t%f\t%f\t%f\n", i+1, r.Scale, r.Bias, r.Error)
+	}
+	tw.Flush()
+}
+
+// The fewest measurements per -chunked window for the fit error to say anything; with two the
+// line passes through both.
+const minChunkSize = 3
+
+// Fits style with opts to every window of size consecutive measurements in ms, printing how the
+// fit evolves over a time ordered capture. Drifting rows suggest the panel or the setup changed
+// during the session.
+func printChunks(ms []Measurement, style ReportingStyle, opts fitOptions, size int) {
+	if size > len(ms) {
+		log.Fatalf("-chunked %d is larger than the %d measurements", size, len(ms))
+	}
+	if size < minChunkSize {
+		warnf("-chunked windows of %d measurements fit exactly; use at least %d", size,
+			minChunkSize)
+	}
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "First line\tLast line\tScale\tBias\tError")
+	for i := 0; i+size <= len(ms); i++ {
+		window := ms[i : i+size]
+		first, last := window[0].Line, window[size-1].Line
+		r, err := Fit(window, style, opts)
+		if err != nil {
+			fmt.Fprintf(tw, "%d\t%d\t%v\n", first, last, err)
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%f\t%f\t%f\n", first, last, r.Scale, r.Bias, r.Error)
+	}
+	tw.Flush()
+}
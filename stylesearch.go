@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// A reporting style built by -style-search from a transform of the reported value, for analysis
+// only: an idc can't express anything but the registered diameter and area styles.
+type transformStyle struct {
+	name        string
+	description string
+	transform   func(float64) float64
+}
+
+func (t transformStyle) Apply(m Measurement) Measurement {
+	m.Reported = t.transform(m.Reported)
+	return m
+}
+
+func (t transformStyle) Type() string {
+	return t.name
+}
+
+func (t transformStyle) Description() string {
+	return t.description
+}
+
+func (t transformStyle) IdcCompatible() bool {
+	return false
+}
+
+// The exponents of the power transforms -style-search tries besides the named ones, 1 and 0.5.
+var searchExponents = []float64{0.1, 0.2, 0.3, 0.4, 0.6, 0.7, 0.8, 0.9, 1.25, 1.5, 1.75, 2}
+
+// How many of the best transforms -style-search prints.
+const searchTop = 3
+
+// Returns the candidate transforms of -style-search: identity, square and cube root, log and
+// reported^p for each of searchExponents.
+func searchStyles() []ReportingStyle {
+	styles := []ReportingStyle{
+		transformStyle{"identity", "physical is linear in reported", func(x float64) float64 { return x }},
+		transformStyle{"sqrt", "physical is linear in sqrt(reported)", math.Sqrt},
+		transformStyle{"cbrt", "physical is linear in cbrt(reported)", math.Cbrt},
+		transformStyle{"log", "physical is linear in log(reported)", func(x float64) float64 {
+			if x <= 0 {
+				return math.NaN()
+			}
+			return math.Log(x)
+		}},
+	}
+	for _, p := range searchExponents {
+		p := p
+		name := "power-" + strconv.FormatFloat(p, 'g', -1, 64)
+		styles = append(styles, transformStyle{name,
+			fmt.Sprintf("physical is linear in reported^%g", p),
+			func(x float64) float64 { return math.Pow(x, p) }})
+	}
+	return styles
+}
+
+// Returns the leave-one-out cross-validation RMS error of fitting style with opts to ms: each
+// measurement is predicted from a fit to all the others. Unlike the fit error, this doesn't
+// reward a transform for bending to the noise in the measurements it was fit to.
+func crossValidationError(ms []Measurement, style ReportingStyle, opts fitOptions) (float64, error) {
+	rest := make([]Measurement, 0, len(ms)-1)
+	sse := float64(0)
+	for i, m := range ms {
+		rest = append(append(rest[:0], ms[:i]...), ms[i+1:]...)
+		r, err := Fit(rest, style, opts)
+		if err != nil {
+			return 0, err
+		}
+		d := m.Physical - Predict(style, r, m.Reported)
+		sse += d * d
+	}
+	return math.Sqrt(sse / float64(len(ms))), nil
+}
+
+// Fits every transform of searchStyles to ms and prints the searchTop with the lowest
+// cross-validation error.
+func printStyleSearch(ms []Measurement, opts fitOptions) {
+	if len(ms) < 3 {
+		log.Fatalf("-style-search needs at least 3 measurements to cross-validate, got %d", len(ms))
+	}
+	type candidate struct {
+		style ReportingStyle
+		r     OptimizationResult
+		cv    float64
+	}
+	var candidates []candidate
+	for _, style := range searchStyles() {
+		r, err := Fit(ms, style, opts)
+		if err != nil {
+			continue
+		}
+		cv, err := crossValidationError(ms, style, opts)
+		if err != nil || math.IsNaN(cv) {
+			continue
+		}
+		candidates = append(candidates, candidate{style, r, cv})
+	}
+	if len(candidates) == 0 {
+		log.Fatal("-style-search: none of the transforms could be fit")
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].cv < candidates[j].cv })
+	if len(candidates) > searchTop {
+		candidates = candidates[:searchTop]
+	}
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Transform\tScale\tBias\tError\tCV error")
+	for _, c := range candidates {
+		fmt.Fprintf(tw, "%s\t%f\t%f\t%f\t%f\n", c.style.Type(), c.r.Scale, c.r.Bias, c.r.Error,
+			c.cv)
+	}
+	tw.Flush()
+	fmt.Printf("Best transform: %s\n", candidates[0].style.Description())
+}
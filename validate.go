@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Returns a description of each place where, with ms sorted by reported value, the physical size
+// decreases. Touch sizes should grow together, so these usually point at transcribed values that
+// were swapped.
+func checkMonotonic(ms []Measurement) []string {
+	sorted := sortedByReported(ms)
+	var problems []string
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1], sorted[i]
+		if cur.Physical < prev.Physical && cur.Reported > prev.Reported {
+			problems = append(problems, fmt.Sprintf(
+				"physical size decreases from %g (%s) to %g (%s) as reported increases from %g to %g",
+				prev.Physical, describeRow(prev), cur.Physical, describeRow(cur),
+				prev.Reported, cur.Reported))
+		}
+	}
+	return problems
+}
+
+// Returns a copy of ms sorted by ascending reported value, keeping the input order of equal
+// values, so that tables read the same whichever order the measurements were captured in.
+func sortedByReported(ms []Measurement) []Measurement {
+	sorted := make([]Measurement, len(ms))
+	copy(sorted, ms)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Reported < sorted[j].Reported
+	})
+	return sorted
+}
+
+// Returns ms without the measurements that repeat an earlier one's physical and reported values
+// exactly, and the number removed. Such rows add nothing to the fit but count for more when the
+// measurements are weighted by replicates.
+func dropDuplicates(ms []Measurement) ([]Measurement, int) {
+	type point struct{ physical, reported float64 }
+	seen := make(map[point]bool)
+	var unique []Measurement
+	for _, m := range ms {
+		p := point{m.Physical, m.Reported}
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, m)
+		}
+	}
+	return unique, len(ms) - len(unique)
+}
+
+// The smallest standard deviation of the physical sizes, relative to their mean, that
+// checkPhysicalRange accepts.
+const minPhysicalSpread = 0.1
+
+// Returns a description of the problem if the physical sizes in ms are clustered too tightly to
+// calibrate the scale against, for example because every measurement used the same finger, or ""
+// if they span a usable range.
+func checkPhysicalRange(ms []Measurement) string {
+	if len(ms) < 2 {
+		return ""
+	}
+	physical := make([]float64, len(ms))
+	lo, hi := ms[0].Physical, ms[0].Physical
+	for i, m := range ms {
+		physical[i] = m.Physical
+		lo, hi = math.Min(lo, m.Physical), math.Max(hi, m.Physical)
+	}
+	avg := average(physical)
+	if avg == 0 || stddev(physical, avg)/math.Abs(avg) >= minPhysicalSpread {
+		return ""
+	}
+	return fmt.Sprintf("physical sizes only range from %g to %g mm, which is too narrow to "+
+		"calibrate the scale; measure a range of contact sizes", lo, hi)
+}
+
+// The smallest fraction of the kernel's declared ABS_MT_TOUCH_MAJOR range that the reported values
+// must span before checkAbsRange stops warning.
+const minDeclaredCoverage = 0.5
+
+// Returns the fraction of the declared range of reported values that those in ms span, and a
+// description of the problem if some fall outside it or they cover too little of it, in which
+// case predictions for large contacts are extrapolated, or "" if the coverage is adequate.
+func checkAbsRange(ms []Measurement, declared valueRange) (float64, string) {
+	measured := reportedRange(ms)
+	coverage := (math.Min(measured.Hi, declared.Hi) - math.Max(measured.Lo, declared.Lo)) /
+		(declared.Hi - declared.Lo)
+	coverage = math.Max(coverage, 0)
+	switch {
+	case !declared.Contains(measured.Lo) || !declared.Contains(measured.Hi):
+		return coverage, fmt.Sprintf("reported values range from %g to %g, outside the %g to %g "+
+			"the kernel declares; check -abs-range and -reported-offset", measured.Lo, measured.Hi,
+			declared.Lo, declared.Hi)
+	case coverage < minDeclaredCoverage:
+		return coverage, fmt.Sprintf("reported values only cover %.1f%% of the %g to %g the kernel "+
+			"declares, so the calibration is extrapolated beyond %g; measure larger contacts",
+			100*coverage, declared.Lo, declared.Hi, measured.Hi)
+	}
+	return coverage, ""
+}
+
+// Reports whether every reported value in ms is a whole number, as when the kernel reports
+// quantized sizes.
+func integerReported(ms []Measurement) bool {
+	for _, m := range ms {
+		if m.Reported != math.Trunc(m.Reported) {
+			return false
+		}
+	}
+	return true
+}
+
+// Names the input row a measurement was read from.
+func describeRow(m Measurement) string {
+	if m.Line == 0 {
+		return "unknown line"
+	}
+	return fmt.Sprintf("line %d", m.Line)
+}
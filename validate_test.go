@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The residual, parity and monotonicity reports sort by reported value, so feeding them the
+// measurements in reverse must give the same results as in ascending order.
+func TestReportsIgnoreInputOrder(t *testing.T) {
+	ascending := []Measurement{
+		{Physical: 3, Reported: 1, Weight: 1, Line: 1},
+		{Physical: 5.2, Reported: 2, Weight: 1, Line: 2},
+		// Smaller than the previous size, so checkMonotonic has something to report.
+		{Physical: 4.9, Reported: 3, Weight: 1, Line: 3},
+		{Physical: 9.1, Reported: 4, Weight: 1, Line: 4},
+		{Physical: 11, Reported: 5, Weight: 1, Line: 5},
+	}
+	reversed := make([]Measurement, len(ascending))
+	for i, m := range ascending {
+		reversed[len(ascending)-1-i] = m
+	}
+	style := lookupStyle("diameter")
+	r := fitStyle(ascending, style, fitOptions{})
+
+	want := checkMonotonic(ascending)
+	if len(want) == 0 {
+		t.Fatal("checkMonotonic found no problem with the ascending measurements")
+	}
+	if got := checkMonotonic(reversed); !reflect.DeepEqual(got, want) {
+		t.Errorf("checkMonotonic of the reversed measurements = %q, want %q", got, want)
+	}
+
+	reports := map[string]func(ms []Measurement){
+		"printPixelResiduals": func(ms []Measurement) { printPixelResiduals(style, r, ms, 10) },
+		"printParity": func(ms []Measurement) {
+			if err := printParity(style, r, ms, "table"); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"printResidualPlot": func(ms []Measurement) {
+			if err := printResidualPlot(style, r, ms, "gnuplot"); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	for name, report := range reports {
+		want := captureStdout(t, func() { report(ascending) })
+		if got := captureStdout(t, func() { report(reversed) }); got != want {
+			t.Errorf("%s of the reversed measurements printed\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
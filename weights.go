@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The automatic weighting strategies selectable with -weight-scheme, keyed by name. Each sets
+// the weight of every measurement in place, before any -golden-weight or -section-weights factors
+// are applied on top.
+var weightSchemes = map[string]func(ms []Measurement) error{
+	// Keep the weights as read from the input: 1, or 1 / sigma^2 with an uncertainty column.
+	"none": func(ms []Measurement) error { return nil },
+	// w = 1, ignoring any uncertainties in the input.
+	"uniform": func(ms []Measurement) error {
+		for i := range ms {
+			ms[i].Weight = 1
+		}
+		return nil
+	},
+	"inverse-variance": weightInverseVariance,
+	"inverse-residual": weightInverseResidual,
+	// w = 1 / x, for a physical size error that grows in proportion to the reported value x.
+	"inverse-x": func(ms []Measurement) error {
+		for _, m := range ms {
+			if m.Reported <= 0 {
+				return fmt.Errorf("reported value %g on line %d is not positive", m.Reported, m.Line)
+			}
+		}
+		for i := range ms {
+			ms[i].Weight = 1 / ms[i].Reported
+		}
+		return nil
+	},
+}
+
+// Returns the names of the weight schemes, sorted, for usage and error messages.
+func weightSchemeNames() string {
+	var names []string
+	for name := range weightSchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// w = 1 / s^2, where s^2 is the sample variance of the reported values of the replicates sharing
+// the measurement's physical size. Groups without at least two distinct reported values fall back
+// to the variance pooled across every group, so a lucky pair of equal replicates can't get an
+// infinite weight.
+func weightInverseVariance(ms []Measurement) error {
+	groups, members := groupReplicates(ms)
+	pooled := pooledVariance(groups)
+	if math.IsNaN(pooled) {
+		return fmt.Errorf("needs replicate measurements at some physical size with " +
+			"differing reported values")
+	}
+	for i, g := range groups {
+		for _, j := range members[i] {
+			ms[j].Weight = 1 / g.varianceOr(pooled)
+		}
+	}
+	return nil
+}
+
+// w = 1 / max(|r|, rms / 10), where r is the measurement's residual under an unweighted least
+// squares fit of physical against reported and rms the fit's RMS residual. Since the residuals
+// depend on the style, fitStyle applies this to each style's transformed measurements when
+// fitOptions.InverseResidual is set, rather than -weight-scheme to the raw ones. Measurements far from
+// the line count for less; the floor keeps one that happens to lie on it from dominating.
+func weightInverseResidual(ms []Measurement) error {
+	scale, bias := findScaleAndBias(ms)
+	res := make([]float64, len(ms))
+	sse := float64(0)
+	for i, m := range ms {
+		res[i] = m.Physical - (bias + scale*m.Reported)
+		sse += res[i] * res[i]
+	}
+	floor := math.Sqrt(sse/float64(len(ms))) / 10
+	if floor == 0 || math.IsNaN(floor) {
+		return fmt.Errorf("every measurement lies on the least squares line")
+	}
+	for i := range ms {
+		ms[i].Weight = 1 / math.Max(math.Abs(res[i]), floor)
+	}
+	return nil
+}
+
+// A set of replicate measurements at one physical size, reduced to its mean.
+type replicateGroup struct {
+	Mean  Measurement
+	Count int
+	// The sample variance of the replicates' reported values, or NaN with a single replicate.
+	Variance float64
+}
+
+// Returns the group's variance, or pooled where the group has no spread to estimate it from.
+func (g replicateGroup) varianceOr(pooled float64) float64 {
+	if math.IsNaN(g.Variance) || g.Variance == 0 {
+		return pooled
+	}
+	return g.Variance
+}
+
+// Groups the measurements in ms by physical size, in order of first appearance, and returns
+// each group, with its mean reported value, beside the indexes in ms of its members. Both
+// -weight-scheme inverse-variance and -average-replicates group this way, so that they agree on
+// what a replicate is.
+func groupReplicates(ms []Measurement) ([]replicateGroup, [][]int) {
+	index := make(map[float64]int)
+	var groups []replicateGroup
+	var members [][]int
+	for j, m := range ms {
+		i, ok := index[m.Physical]
+		if !ok {
+			i = len(groups)
+			index[m.Physical] = i
+			groups = append(groups, replicateGroup{Mean: m})
+			members = append(members, nil)
+		}
+		members[i] = append(members[i], j)
+	}
+	for i, g := range members {
+		mean := float64(0)
+		for _, j := range g {
+			mean += ms[j].Reported
+		}
+		mean /= float64(len(g))
+		groups[i].Mean.Reported = mean
+		groups[i].Count = len(g)
+		groups[i].Variance = math.NaN()
+		if len(g) > 1 {
+			gss := float64(0)
+			for _, j := range g {
+				gss += (ms[j].Reported - mean) * (ms[j].Reported - mean)
+			}
+			groups[i].Variance = gss / float64(len(g)-1)
+		}
+	}
+	return groups, members
+}
+
+// Returns the variance of the reported values pooled across the groups with replicates, or NaN
+// if none of them has any spread.
+func pooledVariance(groups []replicateGroup) float64 {
+	ss, df := float64(0), 0
+	for _, g := range groups {
+		if !math.IsNaN(g.Variance) {
+			ss += g.Variance * float64(g.Count-1)
+			df += g.Count - 1
+		}
+	}
+	if ss == 0 {
+		return math.NaN()
+	}
+	return ss / float64(df)
+}
+
+// Returns the mean of each group of replicates in ms, as grouped by groupReplicates, weighted as
+// weighting says: "count" weights a mean by the number of replicates n, since the variance of a
+// mean of n is that of one replicate over n, and "count/variance" by n / s^2, with s^2 the
+// variance of the group's reported values, or the variance pooled across the groups where a
+// group has no spread to estimate it from.
+func averageReplicates(ms []Measurement, weighting string) ([]replicateGroup, error) {
+	if weighting != "count" && weighting != "count/variance" {
+		return nil, fmt.Errorf("unknown weighting %q, expected count or count/variance", weighting)
+	}
+	groups, _ := groupReplicates(ms)
+	pooled := pooledVariance(groups)
+	if weighting == "count/variance" && math.IsNaN(pooled) {
+		return nil, fmt.Errorf("count/variance needs replicates at some physical size with " +
+			"differing reported values")
+	}
+	for i := range groups {
+		n := float64(groups[i].Count)
+		groups[i].Mean.Weight = n
+		if weighting == "count/variance" {
+			groups[i].Mean.Weight = n / groups[i].varianceOr(pooled)
+		}
+	}
+	return groups, nil
+}
+
+// Prints the replicate count and weight of each group mean.
+func printReplicateGroups(groups []replicateGroup) {
+	tw := newTable(os.Stdout)
+	fmt.Fprintln(tw, "Physical\tMean reported\tCount\tWeight")
+	for _, g := range groups {
+		fmt.Fprintf(tw, "%f\t%f\t%d\t%f\n", g.Mean.Physical, g.Mean.Reported, g.Count,
+			g.Mean.Weight)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// -weight-scheme inverse-variance and -average-replicates count/variance must agree on the
+// groups and their variances: each replicate gets 1 / s^2 and each group mean n / s^2.
+func TestReplicateWeightingAgrees(t *testing.T) {
+	ms := []Measurement{
+		{Physical: 2, Reported: 1, Weight: 1},
+		{Physical: 2, Reported: 3, Weight: 1},
+		{Physical: 4, Reported: 5, Weight: 1},
+		{Physical: 4, Reported: 5, Weight: 1},
+		{Physical: 4, Reported: 8, Weight: 1},
+		{Physical: 6, Reported: 9, Weight: 1},
+	}
+	groups, err := averageReplicates(ms, "count/variance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want one for each of the 3 physical sizes", len(groups))
+	}
+	weighted := append([]Measurement(nil), ms...)
+	if err := weightInverseVariance(weighted); err != nil {
+		t.Fatal(err)
+	}
+	// The variances are 2 and 3, pooled to (2 + 2*3) / 3 for the single replicate at 6.
+	want := map[float64]float64{2: 1.0 / 2, 4: 1.0 / 3, 6: 3.0 / 8}
+	for _, m := range weighted {
+		if math.Abs(m.Weight-want[m.Physical]) > testTolerance {
+			t.Errorf("inverse-variance weight at physical %g is %f, want %f", m.Physical,
+				m.Weight, want[m.Physical])
+		}
+	}
+	for _, g := range groups {
+		w := float64(g.Count) * want[g.Mean.Physical]
+		if math.Abs(g.Mean.Weight-w) > testTolerance {
+			t.Errorf("count/variance weight at physical %g is %f, want %f", g.Mean.Physical,
+				g.Mean.Weight, w)
+		}
+	}
+}